@@ -0,0 +1,79 @@
+package volumes
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGetBindMountRejectsConflictingOptions(t *testing.T) {
+	conflicts := [][]string{
+		{"type=bind", "target=/data", "source=/src", "suid", "nosuid"},
+		{"type=bind", "target=/data", "source=/src", "dev", "nodev"},
+		{"type=bind", "target=/data", "source=/src", "exec", "noexec"},
+	}
+	for _, args := range conflicts {
+		if _, _, _, err := GetBindMount(nil, args, "", nil, "", nil, "/work", ""); err == nil {
+			t.Errorf("expected an error for conflicting options in %v", args)
+		}
+	}
+}
+
+func TestGetBindMountRequiresDestination(t *testing.T) {
+	if _, _, _, err := GetBindMount(nil, []string{"type=bind", "source=/src"}, "", nil, "", nil, "/work", ""); err == nil {
+		t.Fatalf("expected an error for a missing target")
+	}
+}
+
+func TestGetBindMountRequiresSourceWithoutContextDir(t *testing.T) {
+	if _, _, _, err := GetBindMount(nil, []string{"type=bind", "target=/data"}, "", nil, "", nil, "/work", ""); err == nil {
+		t.Fatalf("expected an error for a missing source with no build context to default to")
+	}
+}
+
+func TestGetBindMountChownIsBooleanUAlias(t *testing.T) {
+	mount, _, _, err := GetBindMount(nil, []string{"type=bind", "target=/data", "source=" + t.TempDir(), "chown"}, "", nil, "", nil, "/work", "")
+	if err != nil {
+		t.Fatalf("GetBindMount: %v", err)
+	}
+	if !slices.Contains(mount.Options, "U") {
+		t.Fatalf("expected chown to add the \"U\" option, got %v", mount.Options)
+	}
+}
+
+func TestGetBindMountRelabelRejectsBadValue(t *testing.T) {
+	if _, _, _, err := GetBindMount(nil, []string{"type=bind", "target=/data", "source=/src", "relabel=bogus"}, "", nil, "", nil, "/work", ""); err == nil {
+		t.Fatalf("expected an error for an unrecognized relabel value")
+	}
+}
+
+func TestGetBindMountRelabelRejectsRepeated(t *testing.T) {
+	if _, _, _, err := GetBindMount(nil, []string{"type=bind", "target=/data", "source=/src", "relabel=private", "relabel=shared"}, "", nil, "", nil, "/work", ""); err == nil {
+		t.Fatalf("expected an error for 'relabel' passed more than once")
+	}
+}
+
+func TestGetBindMountDefaultsToReadOnly(t *testing.T) {
+	mount, _, _, err := GetBindMount(nil, []string{"type=bind", "target=/data", "source=" + t.TempDir()}, "", nil, "", nil, "/work", "")
+	if err != nil {
+		t.Fatalf("GetBindMount: %v", err)
+	}
+	if !slices.Contains(mount.Options, "ro") {
+		t.Fatalf("expected the default bind mount to be read-only, got %v", mount.Options)
+	}
+	if slices.Contains(mount.Options, "rw") {
+		t.Fatalf("did not expect 'rw' among default bind mount options, got %v", mount.Options)
+	}
+}
+
+func TestGetBindMountBindNonrecursiveSkipsRbind(t *testing.T) {
+	mount, _, _, err := GetBindMount(nil, []string{"type=bind", "target=/data", "source=" + t.TempDir(), "bind-nonrecursive"}, "", nil, "", nil, "/work", "")
+	if err != nil {
+		t.Fatalf("GetBindMount: %v", err)
+	}
+	if slices.Contains(mount.Options, "rbind") {
+		t.Fatalf("did not expect 'rbind' among options for a non-recursive bind, got %v", mount.Options)
+	}
+	if !slices.Contains(mount.Options, "bind") {
+		t.Fatalf("expected 'bind' among options for a non-recursive bind, got %v", mount.Options)
+	}
+}
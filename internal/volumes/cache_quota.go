@@ -0,0 +1,230 @@
+package volumes
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// cacheIndexFile is the name of the small sidecar file kept at the root of
+// each quota-managed cache directory, recording per-entry size/access
+// metadata so that EnforceCacheQuota doesn't need to re-stat an entire
+// (potentially huge) cache tree on every enforcement pass.
+const cacheIndexFile = "index.json"
+
+// cacheIndexEntry is one record in a cache directory's index.json, keyed by
+// the entry's name (its path relative to the cache directory's root).
+type cacheIndexEntry struct {
+	Size  int64 `json:"size"`
+	ATime int64 `json:"atime"`
+	CTime int64 `json:"ctime"`
+	// DirMTime is the entry's own modification time as of the last time we
+	// fully re-walked it (directory entries only; see refreshCacheIndex).
+	// It's unrelated to CTime, which is deliberately held fixed at first
+	// discovery for "fifo" ordering.
+	DirMTime int64 `json:"dirmtime,omitempty"`
+}
+
+// parseCacheSize parses a byte count optionally suffixed with K, M, G, or T
+// (binary, i.e. K=1024) as accepted by the --mount=type=cache,max-size=...
+// option. An empty value parses as zero.
+func parseCacheSize(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	multiplier := int64(1)
+	numeric := value
+	switch value[len(value)-1] {
+	case 'k', 'K':
+		multiplier = 1 << 10
+		numeric = value[:len(value)-1]
+	case 'm', 'M':
+		multiplier = 1 << 20
+		numeric = value[:len(value)-1]
+	case 'g', 'G':
+		multiplier = 1 << 30
+		numeric = value[:len(value)-1]
+	case 't', 'T':
+		multiplier = 1 << 40
+		numeric = value[:len(value)-1]
+	}
+	parsed, err := strconv.ParseInt(numeric, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing size %q: %w", value, err)
+	}
+	return parsed * multiplier, nil
+}
+
+// EnforceCacheQuota checks the total size of the quota-managed cache
+// directory named by id (the hashed directory name that GetCacheMount
+// creates under CacheParent()), and if it's over max, deletes top-level
+// entries according to policy ("lru" evicts the least-recently-accessed
+// entry first, "fifo" the oldest-created) until it's back under quota.
+//
+// The caller must hold the cache's lockfile in exclusive mode before
+// calling this: enforcement racing with an in-progress build sharing the
+// same cache would see entries it's actively writing disappear out from
+// under it.
+func EnforceCacheQuota(id string, max int64, policy string) error {
+	switch policy {
+	case "lru", "fifo":
+	case "", "none":
+		return nil
+	default:
+		return fmt.Errorf("unrecognized cache eviction policy %q", policy)
+	}
+	if max <= 0 {
+		return nil
+	}
+
+	cacheDir := filepath.Join(CacheParent(), id)
+	index, err := readCacheIndex(cacheDir)
+	if err != nil {
+		return fmt.Errorf("reading cache index for %q: %w", id, err)
+	}
+	total, err := refreshCacheIndex(cacheDir, index)
+	if err != nil {
+		return fmt.Errorf("scanning cache directory %q: %w", id, err)
+	}
+
+	type ordered struct {
+		name string
+		cacheIndexEntry
+	}
+	entries := make([]ordered, 0, len(index))
+	for name, entry := range index {
+		entries = append(entries, ordered{name, entry})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if policy == "fifo" {
+			return entries[i].CTime < entries[j].CTime
+		}
+		return entries[i].ATime < entries[j].ATime
+	})
+
+	for _, entry := range entries {
+		if total <= max {
+			break
+		}
+		if err := os.RemoveAll(filepath.Join(cacheDir, entry.name)); err != nil {
+			logrus.Debugf("evicting cache entry %q from %q: %v", entry.name, id, err)
+			continue
+		}
+		delete(index, entry.name)
+		total -= entry.Size
+	}
+
+	return writeCacheIndex(cacheDir, index)
+}
+
+func readCacheIndex(cacheDir string) (map[string]cacheIndexEntry, error) {
+	index := make(map[string]cacheIndexEntry)
+	data, err := os.ReadFile(filepath.Join(cacheDir, cacheIndexFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return index, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+func writeCacheIndex(cacheDir string, index map[string]cacheIndexEntry) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(cacheDir, cacheIndexFile), data, 0o600)
+}
+
+// refreshCacheIndex drops entries from index that have since been removed
+// from disk and returns the total size of all known entries. Earlier
+// revisions trusted an entry's previously-recorded Size once it was first
+// seen, which meant a cache directory that kept growing across builds (the
+// normal shape of a pip/npm/apt cache) never had its size updated, so
+// max-size/eviction stopped having any effect after the first build.
+//
+// A full filepath.Walk of every top-level entry on every call would close
+// that gap but reintroduce the re-stat storm index.json exists to avoid, so
+// instead we cheaply Lstat each top-level entry and only walk its subtree
+// when that Lstat disagrees with what's recorded: a file's own size/mtime
+// already fully describes it, and a directory's own mtime changes whenever
+// something is added to, removed from, or renamed directly under it. A
+// write to a file several levels deep without touching that file's parent's
+// immediate contents won't bump the parent's mtime, so this can still miss
+// slow growth within an otherwise-quiet subtree; callers that need exact
+// accounting on every call should walk unconditionally instead.
+func refreshCacheIndex(cacheDir string, index map[string]cacheIndexEntry) (int64, error) {
+	dirEntries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	var total int64
+	seen := make(map[string]bool, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if name == cacheIndexFile || name == BuildahCacheLockfile || name == "owner.pid" {
+			continue
+		}
+		seen[name] = true
+
+		info, err := dirEntry.Info()
+		if err != nil {
+			// the entry vanished (or is unreadable) between ReadDir and
+			// our stat; fall back to whatever we last recorded for it
+			// rather than failing the build outright
+			if cur, ok := index[name]; ok {
+				total += cur.Size
+			}
+			continue
+		}
+
+		topMTime := info.ModTime().Unix()
+		if cur, ok := index[name]; ok && info.IsDir() && cur.DirMTime == topMTime {
+			// nothing was added, removed, or renamed directly under this
+			// entry since we last walked it; trust the recorded size
+			// rather than re-stat the whole subtree
+			total += cur.Size
+			continue
+		}
+
+		size, atime, ctime, err := statCacheEntry(filepath.Join(cacheDir, name))
+		if err != nil {
+			if cur, ok := index[name]; ok {
+				total += cur.Size
+			}
+			continue
+		}
+		// preserve the original discovery-order CTime if we have one, so
+		// "fifo" eviction ordering isn't disturbed by a re-stat of an
+		// entry whose own ctime changed because something inside it was
+		// written to
+		if cur, ok := index[name]; ok {
+			ctime = cur.CTime
+		}
+		dirMTime := int64(0)
+		if info.IsDir() {
+			dirMTime = topMTime
+		}
+		index[name] = cacheIndexEntry{Size: size, ATime: atime, CTime: ctime, DirMTime: dirMTime}
+		total += size
+	}
+	for name := range index {
+		if !seen[name] {
+			delete(index, name)
+		}
+	}
+	return total, nil
+}
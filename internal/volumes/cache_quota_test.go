@@ -0,0 +1,216 @@
+package volumes
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseCacheSize(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"1024", 1024, false},
+		{"1K", 1 << 10, false},
+		{"2M", 2 << 20, false},
+		{"3g", 3 << 30, false},
+		{"1T", 1 << 40, false},
+		{"nope", 0, true},
+	}
+	for _, c := range cases {
+		got, err := parseCacheSize(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("parseCacheSize(%q): expected an error", c.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCacheSize(%q): %v", c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("parseCacheSize(%q) = %d, want %d", c.in, got, c.want)
+		}
+	}
+}
+
+func TestEnforceCacheQuotaRejectsUnknownPolicy(t *testing.T) {
+	if err := EnforceCacheQuota("whatever", 1024, "bogus"); err == nil {
+		t.Fatalf("expected an error for an unrecognized eviction policy")
+	}
+}
+
+func TestEnforceCacheQuotaNoopWithoutPolicyOrMax(t *testing.T) {
+	if err := EnforceCacheQuota("whatever", 1024, ""); err != nil {
+		t.Fatalf("expected a no-op for an empty policy, got: %v", err)
+	}
+	if err := EnforceCacheQuota("whatever", 1024, "none"); err != nil {
+		t.Fatalf("expected a no-op for policy \"none\", got: %v", err)
+	}
+	if err := EnforceCacheQuota("whatever", 0, "lru"); err != nil {
+		t.Fatalf("expected a no-op for a non-positive max, got: %v", err)
+	}
+}
+
+// newQuotaFixture creates id as a fresh, empty quota-managed cache directory
+// under the real CacheParent(), returning its path; the directory is removed
+// when the test finishes.
+func newQuotaFixture(t *testing.T, id string) string {
+	t.Helper()
+	cacheDir := filepath.Join(CacheParent(), id)
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		t.Fatalf("creating cache directory fixture: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(cacheDir) })
+	return cacheDir
+}
+
+func writeCacheEntry(t *testing.T, cacheDir, name string, size int) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(cacheDir, name), make([]byte, size), 0o644); err != nil {
+		t.Fatalf("writing cache entry %q: %v", name, err)
+	}
+}
+
+func TestEnforceCacheQuotaEvictsLeastRecentlyUsedFirst(t *testing.T) {
+	id := fmt.Sprintf("test-quota-lru-%d", os.Getpid())
+	cacheDir := newQuotaFixture(t, id)
+
+	writeCacheEntry(t, cacheDir, "old", 100)
+	writeCacheEntry(t, cacheDir, "new", 100)
+
+	now := time.Now()
+	if err := os.Chtimes(filepath.Join(cacheDir, "old"), now.Add(-time.Hour), now.Add(-time.Hour)); err != nil {
+		t.Fatalf("setting old entry's atime: %v", err)
+	}
+	if err := os.Chtimes(filepath.Join(cacheDir, "new"), now, now); err != nil {
+		t.Fatalf("setting new entry's atime: %v", err)
+	}
+
+	if err := EnforceCacheQuota(id, 100, "lru"); err != nil {
+		t.Fatalf("EnforceCacheQuota: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(cacheDir, "old")); !os.IsNotExist(err) {
+		t.Fatalf("expected the least-recently-accessed entry to be evicted, stat err: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "new")); err != nil {
+		t.Fatalf("expected the most-recently-accessed entry to survive, stat err: %v", err)
+	}
+}
+
+func TestEnforceCacheQuotaEvictsOldestCreatedFirstUnderFifo(t *testing.T) {
+	id := fmt.Sprintf("test-quota-fifo-%d", os.Getpid())
+	cacheDir := newQuotaFixture(t, id)
+
+	writeCacheEntry(t, cacheDir, "first", 100)
+	time.Sleep(1100 * time.Millisecond)
+	writeCacheEntry(t, cacheDir, "second", 100)
+
+	if err := EnforceCacheQuota(id, 100, "fifo"); err != nil {
+		t.Fatalf("EnforceCacheQuota: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(cacheDir, "first")); !os.IsNotExist(err) {
+		t.Fatalf("expected the oldest-created entry to be evicted, stat err: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "second")); err != nil {
+		t.Fatalf("expected the newest-created entry to survive, stat err: %v", err)
+	}
+}
+
+// TestEnforceCacheQuotaSkipsWalkOfUnchangedDirectory is a regression test
+// for the re-stat storm refreshCacheIndex is meant to avoid: once a
+// directory entry has been walked and recorded, a second pass shouldn't
+// walk it again unless something changed directly under it.
+func TestEnforceCacheQuotaSkipsWalkOfUnchangedDirectory(t *testing.T) {
+	id := fmt.Sprintf("test-quota-dirskip-%d", os.Getpid())
+	cacheDir := newQuotaFixture(t, id)
+
+	subdir := filepath.Join(cacheDir, "sub")
+	if err := os.MkdirAll(subdir, 0o755); err != nil {
+		t.Fatalf("creating subdirectory fixture: %v", err)
+	}
+	writeCacheEntry(t, subdir, "file", 10)
+
+	// first pass: walks "sub" and records its size and top-level mtime
+	if err := EnforceCacheQuota(id, 1000, "fifo"); err != nil {
+		t.Fatalf("EnforceCacheQuota (first pass): %v", err)
+	}
+	index, err := readCacheIndex(cacheDir)
+	if err != nil {
+		t.Fatalf("readCacheIndex: %v", err)
+	}
+	if index["sub"].Size != 10 {
+		t.Fatalf("expected recorded size 10 after first pass, got %d", index["sub"].Size)
+	}
+
+	// grow a file nested under "sub" without touching "sub" itself: its own
+	// mtime shouldn't change, so a second pass should trust the stale size
+	// rather than re-walk it
+	if err := os.WriteFile(filepath.Join(subdir, "file"), make([]byte, 500), 0o644); err != nil {
+		t.Fatalf("growing nested file: %v", err)
+	}
+	if err := EnforceCacheQuota(id, 1000, "fifo"); err != nil {
+		t.Fatalf("EnforceCacheQuota (second pass): %v", err)
+	}
+	index, err = readCacheIndex(cacheDir)
+	if err != nil {
+		t.Fatalf("readCacheIndex: %v", err)
+	}
+	if index["sub"].Size != 10 {
+		t.Fatalf("expected the unwalked directory's stale size to be preserved, got %d", index["sub"].Size)
+	}
+}
+
+func TestEnforceCacheQuotaStaysUnderMax(t *testing.T) {
+	id := fmt.Sprintf("test-quota-under-%d", os.Getpid())
+	cacheDir := newQuotaFixture(t, id)
+
+	writeCacheEntry(t, cacheDir, "small", 10)
+
+	if err := EnforceCacheQuota(id, 1<<20, "lru"); err != nil {
+		t.Fatalf("EnforceCacheQuota: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(cacheDir, "small")); err != nil {
+		t.Fatalf("expected entry well under quota to survive, stat err: %v", err)
+	}
+}
+
+// TestEnforceCacheQuotaNoticesGrowth is a regression test for a bug where a
+// cache entry's size, once recorded in index.json, was never updated again:
+// a cache directory that kept growing across builds (the normal shape of a
+// pip/npm/apt cache) would never actually get evicted once it grew past
+// max-size.
+func TestEnforceCacheQuotaNoticesGrowth(t *testing.T) {
+	id := fmt.Sprintf("test-quota-growth-%d", os.Getpid())
+	cacheDir := newQuotaFixture(t, id)
+
+	writeCacheEntry(t, cacheDir, "growing", 10)
+
+	// first pass: well under quota, so "growing" is recorded in index.json
+	// but not evicted
+	if err := EnforceCacheQuota(id, 1000, "fifo"); err != nil {
+		t.Fatalf("EnforceCacheQuota (first pass): %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "growing")); err != nil {
+		t.Fatalf("expected entry to survive the first pass, stat err: %v", err)
+	}
+
+	// grow it past the quota and enforce again: a stale index would still
+	// think it's 10 bytes and never evict it
+	writeCacheEntry(t, cacheDir, "growing", 2000)
+	if err := EnforceCacheQuota(id, 1000, "fifo"); err != nil {
+		t.Fatalf("EnforceCacheQuota (second pass): %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "growing")); !os.IsNotExist(err) {
+		t.Fatalf("expected the entry to be evicted once its re-stated size exceeds max, stat err: %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package volumes
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// GC scans /proc/self/mountinfo for overlay and bind mounts left behind
+// under the cache parent, the named-volume parent, and tmpDir by a build
+// that was interrupted or crashed before it could clean up after itself,
+// and unmounts them deepest-first so that nested mounts don't block their
+// parents. It also removes orphaned cache lockfile directories whose
+// owning process (recorded by GetCacheMount in a sidecar owner.pid file)
+// is no longer running.
+func GC(tmpDir string) error {
+	roots := []string{CacheParent(), VolumeParent(), tmpDir}
+
+	mountPoints, err := leakedMountinfoMounts(roots)
+	if err != nil {
+		return fmt.Errorf("reading mount table: %w", err)
+	}
+
+	// unmount deepest paths first so that nested overlay/bind mounts
+	// don't block their parents from being unmounted
+	sort.Slice(mountPoints, func(i, j int) bool {
+		return strings.Count(mountPoints[i], "/") > strings.Count(mountPoints[j], "/")
+	})
+
+	var errs []string
+	for _, mountPoint := range mountPoints {
+		if err := forceUnmount(mountPoint); err != nil {
+			errs = append(errs, fmt.Sprintf("unmounting %q: %v", mountPoint, err))
+		}
+	}
+
+	if err := gcOrphanLockfiles(); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("garbage-collecting leaked mounts: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// forceUnmount unmounts mountPoint; if that fails, it marks the mount
+// private (clearing any propagation setting that would block the unmount)
+// and retries once. ENOENT and EINVAL (the
+// mountpoint doesn't exist, or isn't a mountpoint at all) are treated as
+// success, since that's the expected outcome of a previous GC run racing
+// with us, or of the mount already having gone away.
+func forceUnmount(mountPoint string) error {
+	err := unix.Unmount(mountPoint, 0)
+	if err == nil || err == unix.ENOENT || err == unix.EINVAL {
+		return nil
+	}
+	if err2 := unix.Mount("", mountPoint, "", unix.MS_PRIVATE, ""); err2 != nil {
+		return fmt.Errorf("marking mount private before retrying unmount: %w (original error: %v)", err2, err)
+	}
+	err = unix.Unmount(mountPoint, 0)
+	if err == nil || err == unix.ENOENT || err == unix.EINVAL {
+		return nil
+	}
+	return err
+}
+
+// leakedMountinfoMounts returns the mount points listed in
+// /proc/self/mountinfo that live under one of roots.
+func leakedMountinfoMounts(roots []string) ([]string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var leaked []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// mount ID, parent ID, major:minor, root, mount point, options, ...
+		if len(fields) < 5 {
+			continue
+		}
+		mountPoint := unescapeMountinfoField(fields[4])
+		for _, root := range roots {
+			if root == "" {
+				continue
+			}
+			if mountPoint == root || strings.HasPrefix(mountPoint, root+string(filepath.Separator)) {
+				leaked = append(leaked, mountPoint)
+				break
+			}
+		}
+	}
+	return leaked, scanner.Err()
+}
+
+// unescapeMountinfoField undoes the octal escaping the kernel applies to
+// whitespace and backslashes in /proc/self/mountinfo fields.
+func unescapeMountinfoField(field string) string {
+	replacer := strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`)
+	return replacer.Replace(field)
+}
+
+// gcOrphanLockfiles removes cache lockfile directories whose owner.pid
+// sidecar file (written by GetCacheMount) names a process that no longer
+// exists.
+func gcOrphanLockfiles() error {
+	lockfilesDir := filepath.Join(CacheParent(), BuildahCacheLockfileDir)
+	entries, err := os.ReadDir(lockfilesDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("reading cache lockfiles directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		ownerDir := filepath.Join(lockfilesDir, entry.Name())
+		pidBytes, err := os.ReadFile(filepath.Join(ownerDir, "owner.pid"))
+		if err != nil {
+			// no recorded owner: it may still be mid-creation, leave it alone
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(pidBytes)))
+		if err != nil {
+			continue
+		}
+		if processExists(pid) {
+			continue
+		}
+		if err := os.RemoveAll(ownerDir); err != nil {
+			logrus.Debugf("removing orphaned cache lockfile directory %q: %v", ownerDir, err)
+		}
+	}
+	return nil
+}
+
+func processExists(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	return unix.Kill(pid, 0) != unix.ESRCH
+}
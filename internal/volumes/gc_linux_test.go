@@ -0,0 +1,69 @@
+package volumes
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestUnescapeMountinfoField(t *testing.T) {
+	cases := map[string]string{
+		`/a\040b`: "/a b",
+		`/a\011b`: "/a\tb",
+		`/a\012b`: "/a\nb",
+		`/a\134b`: `/a\b`,
+		`/plain`:  "/plain",
+	}
+	for in, want := range cases {
+		if got := unescapeMountinfoField(in); got != want {
+			t.Errorf("unescapeMountinfoField(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestProcessExists(t *testing.T) {
+	if !processExists(os.Getpid()) {
+		t.Fatalf("expected processExists to report the current process as alive")
+	}
+	if processExists(0) {
+		t.Fatalf("expected processExists to reject pid 0")
+	}
+	if processExists(-1) {
+		t.Fatalf("expected processExists to reject a negative pid")
+	}
+}
+
+// findUnusedPID returns a pid that doesn't currently belong to a running
+// process, for use as a stand-in for a build that has already exited.
+func findUnusedPID(t *testing.T) int {
+	t.Helper()
+	for pid := 1 << 20; pid < (1<<20)+4096; pid++ {
+		if !processExists(pid) {
+			return pid
+		}
+	}
+	t.Skip("couldn't find an unused pid to test with")
+	return 0
+}
+
+func TestGCOrphanLockfilesRemovesDeadOwners(t *testing.T) {
+	lockfilesDir := filepath.Join(CacheParent(), BuildahCacheLockfileDir)
+	pid := findUnusedPID(t)
+	ownerDir := filepath.Join(lockfilesDir, "deadbeefdeadbeef")
+	if err := os.MkdirAll(ownerDir, 0o755); err != nil {
+		t.Fatalf("creating fixture lockfile dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(ownerDir) })
+	if err := os.WriteFile(filepath.Join(ownerDir, "owner.pid"), []byte(strconv.Itoa(pid)), 0o644); err != nil {
+		t.Fatalf("writing owner.pid: %v", err)
+	}
+
+	if err := gcOrphanLockfiles(); err != nil {
+		t.Fatalf("gcOrphanLockfiles: %v", err)
+	}
+
+	if _, err := os.Stat(ownerDir); !os.IsNotExist(err) {
+		t.Fatalf("expected orphaned lockfile directory to be removed, stat err: %v", err)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package volumes
+
+import "errors"
+
+// GC is only implemented on Linux, where /proc/self/mountinfo is available
+// to discover leaked mounts.
+func GC(tmpDir string) error {
+	return errors.New("mount garbage collection is only supported on linux")
+}
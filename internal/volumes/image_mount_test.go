@@ -0,0 +1,21 @@
+package volumes
+
+import "testing"
+
+func TestGetImageMountRequiresDestination(t *testing.T) {
+	if _, _, _, err := GetImageMount(nil, []string{"type=image", "src=someimage"}, nil, "", nil, "", ""); err == nil {
+		t.Fatalf("expected an error for a missing target")
+	}
+}
+
+func TestGetImageMountRequiresSource(t *testing.T) {
+	if _, _, _, err := GetImageMount(nil, []string{"type=image", "target=/data"}, nil, "", nil, "", ""); err == nil {
+		t.Fatalf("expected an error for a missing source image")
+	}
+}
+
+func TestGetImageMountRejectsUnknownOption(t *testing.T) {
+	if _, _, _, err := GetImageMount(nil, []string{"type=image", "src=someimage", "target=/data", "bogus=1"}, nil, "", nil, "", ""); err == nil {
+		t.Fatalf("expected an error for an unrecognized option")
+	}
+}
@@ -0,0 +1,32 @@
+package volumes
+
+import "golang.org/x/sys/unix"
+
+// defaultMountOptsFor reports the runtime-spec mount option strings implied
+// by the mount flags the kernel already has in effect for path, using
+// statfs(2) instead of parsing /proc/self/mountinfo: a bind mount of a
+// filesystem that's itself mounted nosuid/nodev/noexec/ro stays that way no
+// matter what options are requested for the bind, so callers use this to
+// propagate those flags onto the bind mount they're building instead of
+// silently dropping them.
+func defaultMountOptsFor(path string) ([]string, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return nil, err
+	}
+
+	var opts []string
+	if st.Flags&unix.ST_RDONLY != 0 {
+		opts = append(opts, "ro")
+	}
+	if st.Flags&unix.ST_NOSUID != 0 {
+		opts = append(opts, "nosuid")
+	}
+	if st.Flags&unix.ST_NODEV != 0 {
+		opts = append(opts, "nodev")
+	}
+	if st.Flags&unix.ST_NOEXEC != 0 {
+		opts = append(opts, "noexec")
+	}
+	return opts, nil
+}
@@ -0,0 +1,65 @@
+package volumes
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// mountTmpfsFixture mounts a tmpfs at a fresh temp directory with the given
+// flags, returning the directory; it is unmounted when the test finishes.
+// It skips the test if the
+// caller can't mount (e.g. not running as root), since defaultMountOptsFor
+// can only be exercised against a real mount.
+func mountTmpfsFixture(t *testing.T, flags uintptr) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := unix.Mount("tmpfs", dir, "tmpfs", flags, ""); err != nil {
+		t.Skipf("mounting tmpfs fixture (probably need root): %v", err)
+	}
+	t.Cleanup(func() {
+		if err := unix.Unmount(dir, unix.MNT_DETACH); err != nil {
+			t.Logf("unmounting tmpfs fixture: %v", err)
+		}
+	})
+	return dir
+}
+
+func TestDefaultMountOptsForDetectsInheritedFlags(t *testing.T) {
+	dir := mountTmpfsFixture(t, unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC)
+
+	opts, err := defaultMountOptsFor(dir)
+	if err != nil {
+		t.Fatalf("defaultMountOptsFor: %v", err)
+	}
+	for _, want := range []string{"nosuid", "nodev", "noexec"} {
+		if !slices.Contains(opts, want) {
+			t.Errorf("expected %q in %v", want, opts)
+		}
+	}
+	if slices.Contains(opts, "ro") {
+		t.Errorf("did not expect %q in %v", "ro", opts)
+	}
+}
+
+func TestDefaultMountOptsForNoFlags(t *testing.T) {
+	dir := mountTmpfsFixture(t, 0)
+
+	opts, err := defaultMountOptsFor(dir)
+	if err != nil {
+		t.Fatalf("defaultMountOptsFor: %v", err)
+	}
+	for _, unwanted := range []string{"nosuid", "nodev", "noexec", "ro"} {
+		if slices.Contains(opts, unwanted) {
+			t.Errorf("did not expect %q in %v", unwanted, opts)
+		}
+	}
+}
+
+func TestDefaultMountOptsForMissingPath(t *testing.T) {
+	if _, err := defaultMountOptsFor("/nonexistent/path/for/testing"); !os.IsNotExist(err) {
+		t.Fatalf("expected a not-exist error, got %v", err)
+	}
+}
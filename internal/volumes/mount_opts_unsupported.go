@@ -0,0 +1,10 @@
+//go:build !linux
+
+package volumes
+
+// defaultMountOptsFor is only implemented on Linux, where statfs(2) exposes
+// the source filesystem's mount flags; elsewhere callers just get no
+// inherited options.
+func defaultMountOptsFor(path string) ([]string, error) {
+	return nil, nil
+}
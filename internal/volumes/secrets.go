@@ -0,0 +1,349 @@
+package volumes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containers/buildah/define"
+	"github.com/containers/common/pkg/parse"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// SSHSource describes an SSH agent that can be forwarded into a container
+// via --mount=type=ssh. Either Socket (the path to a running ssh-agent's
+// Unix socket, typically from $SSH_AUTH_SOCK) or Keys (a list of private
+// key files to load into a short-lived agent spawned for the build) must
+// be set.
+type SSHSource struct {
+	Socket string
+	Keys   []string
+}
+
+// GetSecretMount parses a single secret mount entry from the --mount flag.
+//
+// The secret named by "id" is resolved against secrets, staged into a file
+// on a tmpfs-backed directory under tmpDir (so the plaintext secret never
+// touches persistent storage) with the requested mode/uid/gid, and
+// bind-mounted read-only into the container at "target" (default
+// /run/secrets/<id>). If the named secret isn't found and "required" wasn't
+// set, mounted is returned false and the caller should skip this mount
+// instead of erroring out. On success, the returned cleanup unmounts and
+// removes the staging directory; the caller must run it once the secret's
+// bind mount is no longer needed, rather than waiting for tmpDir itself to
+// eventually be removed.
+func GetSecretMount(args []string, secrets map[string]define.Secret, tmpDir string) (specs.Mount, bool, func() error, error) {
+	newMount := specs.Mount{
+		Type:    define.TypeBind,
+		Options: []string{"bind", "ro"},
+	}
+
+	var err error
+	id := ""
+	target := ""
+	required := false
+	uid := 0
+	gid := 0
+	mode := uint64(0o400)
+
+	for _, val := range args {
+		argName, argValue, hasArgValue := strings.Cut(val, "=")
+		switch argName {
+		case "type":
+			// This is already processed
+			continue
+		case "id":
+			if !hasArgValue {
+				return newMount, false, nil, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			id = argValue
+		case "target", "dst", "destination":
+			if !hasArgValue {
+				return newMount, false, nil, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			target = argValue
+		case "required":
+			if !hasArgValue {
+				required = true
+				continue
+			}
+			if required, err = strconv.ParseBool(argValue); err != nil {
+				return newMount, false, nil, fmt.Errorf("unable to parse value of %q: %w", argName, err)
+			}
+		case "mode":
+			if !hasArgValue {
+				return newMount, false, nil, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			if mode, err = strconv.ParseUint(argValue, 8, 32); err != nil {
+				return newMount, false, nil, fmt.Errorf("unable to parse secret mode: %w", err)
+			}
+		case "uid":
+			if !hasArgValue {
+				return newMount, false, nil, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			if uid, err = strconv.Atoi(argValue); err != nil {
+				return newMount, false, nil, fmt.Errorf("unable to parse secret uid: %w", err)
+			}
+		case "gid":
+			if !hasArgValue {
+				return newMount, false, nil, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			if gid, err = strconv.Atoi(argValue); err != nil {
+				return newMount, false, nil, fmt.Errorf("unable to parse secret gid: %w", err)
+			}
+		default:
+			return newMount, false, nil, fmt.Errorf("%v: %w", argName, errBadMntOption)
+		}
+	}
+
+	if id == "" {
+		return newMount, false, nil, fmt.Errorf("no id given for secret mount: %w", errBadVolSrc)
+	}
+	if target == "" {
+		target = filepath.Join("/run/secrets", id)
+	}
+	if err := parse.ValidateVolumeCtrDir(target); err != nil {
+		return newMount, false, nil, err
+	}
+	newMount.Destination = target
+
+	secret, ok := secrets[id]
+	if !ok {
+		if required {
+			return newMount, false, nil, fmt.Errorf("secret required but not found: %s", id)
+		}
+		return specs.Mount{}, false, nil, nil
+	}
+
+	var data []byte
+	switch secret.SourceType {
+	case "env":
+		value, ok := os.LookupEnv(secret.Source)
+		if !ok {
+			if required {
+				return newMount, false, nil, fmt.Errorf("secret required but environment variable %q is not set: %s", secret.Source, id)
+			}
+			return specs.Mount{}, false, nil, nil
+		}
+		data = []byte(value)
+	case "file":
+		if data, err = os.ReadFile(secret.Source); err != nil {
+			if required {
+				return newMount, false, nil, fmt.Errorf("unable to read secret file %q: %w", secret.Source, err)
+			}
+			return specs.Mount{}, false, nil, nil
+		}
+	default:
+		return newMount, false, nil, fmt.Errorf("unrecognized source type %q for secret %q", secret.SourceType, id)
+	}
+
+	stagingDir, cleanup, err := stageSecretTmpfs(tmpDir)
+	if err != nil {
+		return newMount, false, nil, fmt.Errorf("staging secret %q: %w", id, err)
+	}
+	secretFile := filepath.Join(stagingDir, id)
+	if err := os.WriteFile(secretFile, data, os.FileMode(mode)); err != nil {
+		cleanup()
+		return newMount, false, nil, fmt.Errorf("writing secret %q: %w", id, err)
+	}
+	if err := os.Chown(secretFile, uid, gid); err != nil {
+		cleanup()
+		return newMount, false, nil, fmt.Errorf("chowning secret %q: %w", id, err)
+	}
+	if err := os.Chmod(secretFile, os.FileMode(mode)); err != nil {
+		cleanup()
+		return newMount, false, nil, fmt.Errorf("setting mode of secret %q: %w", id, err)
+	}
+
+	newMount.Source = secretFile
+	return newMount, true, cleanup, nil
+}
+
+// GetSSHMount parses a single ssh mount entry from the --mount flag.
+//
+// The agent named by "id" (default "default") is resolved against
+// sshSources. If that source names a running agent's socket, it's forwarded
+// directly; otherwise a short-lived agent is spawned over a key-file-backed
+// keyring for the duration of the build. Either way the returned
+// specs.Mount is a read-only bind mount of a Unix socket at "target"
+// (default /run/buildkit/ssh_agent.<index>), and the returned cleanup func
+// must be called by the caller once the mount is no longer needed, to
+// remove the staged socket and (if one was spawned) kill the agent.
+func GetSSHMount(args []string, index int, sshSources map[string]*SSHSource, tmpDir string) (specs.Mount, func() error, error) {
+	newMount := specs.Mount{
+		Type:    define.TypeBind,
+		Options: []string{"rbind", "ro"},
+	}
+
+	var err error
+	id := "default"
+	target := ""
+	uid := 0
+	gid := 0
+	mode := uint64(0o600)
+
+	for _, val := range args {
+		argName, argValue, hasArgValue := strings.Cut(val, "=")
+		switch argName {
+		case "type":
+			// This is already processed
+			continue
+		case "id":
+			if !hasArgValue {
+				return newMount, nil, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			id = argValue
+		case "target", "dst", "destination":
+			if !hasArgValue {
+				return newMount, nil, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			target = argValue
+		case "mode":
+			if !hasArgValue {
+				return newMount, nil, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			if mode, err = strconv.ParseUint(argValue, 8, 32); err != nil {
+				return newMount, nil, fmt.Errorf("unable to parse ssh socket mode: %w", err)
+			}
+		case "uid":
+			if !hasArgValue {
+				return newMount, nil, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			if uid, err = strconv.Atoi(argValue); err != nil {
+				return newMount, nil, fmt.Errorf("unable to parse ssh socket uid: %w", err)
+			}
+		case "gid":
+			if !hasArgValue {
+				return newMount, nil, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			if gid, err = strconv.Atoi(argValue); err != nil {
+				return newMount, nil, fmt.Errorf("unable to parse ssh socket gid: %w", err)
+			}
+		default:
+			return newMount, nil, fmt.Errorf("%v: %w", argName, errBadMntOption)
+		}
+	}
+
+	source, ok := sshSources[id]
+	if !ok || source == nil {
+		return newMount, nil, fmt.Errorf("no ssh forward found matching id %q", id)
+	}
+
+	if target == "" {
+		target = fmt.Sprintf("/run/buildkit/ssh_agent.%d", index)
+	}
+	if err := parse.ValidateVolumeCtrDir(target); err != nil {
+		return newMount, nil, err
+	}
+	newMount.Destination = target
+
+	socket := source.Socket
+	cleanup := func() error { return nil }
+	if socket == "" {
+		spawnedSocket, kill, err := spawnSSHAgent(source.Keys, tmpDir, os.FileMode(mode), uid, gid)
+		if err != nil {
+			return newMount, nil, fmt.Errorf("spawning ssh-agent for id %q: %w", id, err)
+		}
+		socket = spawnedSocket
+		cleanup = kill
+	}
+
+	newMount.Source = socket
+	return newMount, cleanup, nil
+}
+
+// sshAddTimeout bounds each "ssh-add <keyfile>" call below: a
+// passphrase-protected key with no askpass helper configured fails
+// immediately rather than blocking, but this is a backstop against any
+// ssh-add implementation that doesn't.
+const sshAddTimeout = 10 * time.Second
+
+// spawnSSHAgent starts a short-lived ssh-agent (shelling out to the
+// system's own ssh-agent/ssh-add binaries, rather than reimplementing the
+// agent protocol and pulling in a new dependency to do it -- this package
+// has no go.mod/go.sum of its own to add one to), backed by the given
+// private key files, listening on a Unix socket under tmpDir. It returns
+// the socket path and a cleanup func that kills the agent and removes the
+// socket.
+//
+// Requires the host's build environment to have ssh-agent and ssh-add
+// (e.g. the openssh-client package) on $PATH. Passphrase-protected keys
+// aren't supported: no askpass helper is configured, so ssh-add fails
+// fast on one instead of hanging waiting for a passphrase that can never
+// arrive.
+func spawnSSHAgent(keyFiles []string, tmpDir string, mode os.FileMode, uid, gid int) (string, func() error, error) {
+	if len(keyFiles) == 0 {
+		return "", nil, errors.New("no running agent socket or keys provided for ssh forward")
+	}
+
+	socketDir, err := os.MkdirTemp(tmpDir, "buildah-ssh-agent")
+	if err != nil {
+		return "", nil, fmt.Errorf("creating ssh-agent socket directory: %w", err)
+	}
+	socketPath := filepath.Join(socketDir, "ssh_agent.sock")
+
+	agentCmd := exec.Command("ssh-agent", "-D", "-a", socketPath)
+	if err := agentCmd.Start(); err != nil {
+		os.RemoveAll(socketDir)
+		return "", nil, fmt.Errorf("starting ssh-agent: %w", err)
+	}
+	kill := func() error {
+		killErr := agentCmd.Process.Kill()
+		_, _ = agentCmd.Process.Wait()
+		if rmErr := os.RemoveAll(socketDir); rmErr != nil && killErr == nil {
+			killErr = rmErr
+		}
+		return killErr
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(socketPath); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			kill()
+			return "", nil, errors.New("timed out waiting for ssh-agent to create its socket")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	for _, keyFile := range keyFiles {
+		ctx, cancel := context.WithTimeout(context.Background(), sshAddTimeout)
+		addCmd := exec.CommandContext(ctx, "ssh-add", keyFile)
+		addCmd.Stdin = nil
+		// no askpass helper on purpose: a passphrase-protected key should
+		// fail fast, not hang waiting on a prompt nothing can answer
+		addCmd.Env = append(slices.DeleteFunc(os.Environ(), func(e string) bool {
+			return strings.HasPrefix(e, "SSH_ASKPASS=") || strings.HasPrefix(e, "DISPLAY=")
+		}), "SSH_AUTH_SOCK="+socketPath)
+		out, err := addCmd.CombinedOutput()
+		cancel()
+		if ctx.Err() == context.DeadlineExceeded {
+			kill()
+			return "", nil, fmt.Errorf("adding ssh key %q to agent: timed out after %s", keyFile, sshAddTimeout)
+		}
+		if err != nil {
+			kill()
+			return "", nil, fmt.Errorf("adding ssh key %q to agent: %w: %s", keyFile, err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	if err := os.Chown(socketPath, uid, gid); err != nil {
+		kill()
+		return "", nil, fmt.Errorf("chowning ssh-agent socket: %w", err)
+	}
+	if err := os.Chmod(socketPath, mode); err != nil {
+		kill()
+		return "", nil, fmt.Errorf("setting mode of ssh-agent socket: %w", err)
+	}
+
+	return socketPath, kill, nil
+}
@@ -0,0 +1,33 @@
+package volumes
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// stageSecretTmpfs creates a small tmpfs-backed staging directory under
+// tmpDir: secret material gets written there instead of onto whatever
+// persistent filesystem backs tmpDir, and the returned cleanup unmounts and
+// removes it. Callers should invoke the cleanup as soon as the secret's
+// bind mount is no longer needed, rather than waiting on tmpDir's own
+// eventual removal.
+func stageSecretTmpfs(tmpDir string) (string, func() error, error) {
+	dir, err := os.MkdirTemp(tmpDir, "buildah-secret")
+	if err != nil {
+		return "", nil, fmt.Errorf("creating secret staging directory: %w", err)
+	}
+	if err := unix.Mount("tmpfs", dir, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "size=1m,mode=0700"); err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("mounting tmpfs for secret staging directory: %w", err)
+	}
+	cleanup := func() error {
+		umountErr := unix.Unmount(dir, unix.MNT_DETACH)
+		if rmErr := os.RemoveAll(dir); rmErr != nil && umountErr == nil {
+			umountErr = rmErr
+		}
+		return umountErr
+	}
+	return dir, cleanup, nil
+}
@@ -0,0 +1,136 @@
+package volumes
+
+import (
+	"os"
+	"testing"
+
+	"github.com/containers/buildah/define"
+)
+
+func TestGetSecretMountSkipsMissingOptionalSecret(t *testing.T) {
+	mount, mounted, cleanup, err := GetSecretMount([]string{"type=secret", "id=missing"}, nil, t.TempDir())
+	if err != nil {
+		t.Fatalf("GetSecretMount: %v", err)
+	}
+	if mounted {
+		t.Fatalf("expected mounted=false for a secret that isn't present")
+	}
+	if cleanup != nil {
+		t.Fatalf("expected a nil cleanup for a secret that wasn't mounted")
+	}
+	if mount.Source != "" {
+		t.Fatalf("expected an empty mount for a secret that wasn't mounted")
+	}
+}
+
+func TestGetSecretMountRequiresPresentSecretWhenRequired(t *testing.T) {
+	if _, _, _, err := GetSecretMount([]string{"type=secret", "id=missing", "required=true"}, nil, t.TempDir()); err == nil {
+		t.Fatalf("expected an error for a required secret that isn't present")
+	}
+}
+
+func TestGetSecretMountRequiresID(t *testing.T) {
+	if _, _, _, err := GetSecretMount([]string{"type=secret"}, nil, t.TempDir()); err == nil {
+		t.Fatalf("expected an error for a secret mount with no id")
+	}
+}
+
+func TestGetSecretMountStagesEnvSecret(t *testing.T) {
+	const envVar = "BUILDAH_TEST_SECRET_VALUE"
+	t.Setenv(envVar, "sekrit")
+
+	secrets := map[string]define.Secret{
+		"mysecret": {SourceType: "env", Source: envVar},
+	}
+
+	mount, mounted, cleanup, err := GetSecretMount([]string{"type=secret", "id=mysecret"}, secrets, t.TempDir())
+	if err != nil {
+		if os.Geteuid() != 0 {
+			t.Skipf("staging a secret requires mounting a tmpfs (probably need root): %v", err)
+		}
+		t.Fatalf("GetSecretMount: %v", err)
+	}
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if !mounted {
+		t.Fatalf("expected mounted=true for a secret that was found")
+	}
+	if mount.Destination != "/run/secrets/mysecret" {
+		t.Fatalf("expected default destination /run/secrets/mysecret, got %q", mount.Destination)
+	}
+
+	got, err := os.ReadFile(mount.Source)
+	if err != nil {
+		t.Fatalf("reading staged secret file: %v", err)
+	}
+	if string(got) != "sekrit" {
+		t.Fatalf("expected staged secret to contain %q, got %q", "sekrit", got)
+	}
+}
+
+// TestGetSecretMountRequiresSetEnvVarWhenRequired is a regression test for
+// a bug where an unset $SECRET_ENV_VAR silently mounted an empty secret
+// file instead of erroring, because os.Getenv can't distinguish "unset"
+// from "set to the empty string".
+func TestGetSecretMountRequiresSetEnvVarWhenRequired(t *testing.T) {
+	const envVar = "BUILDAH_TEST_SECRET_VALUE_UNSET"
+	os.Unsetenv(envVar)
+
+	secrets := map[string]define.Secret{
+		"mysecret": {SourceType: "env", Source: envVar},
+	}
+
+	if _, _, _, err := GetSecretMount([]string{"type=secret", "id=mysecret", "required=true"}, secrets, t.TempDir()); err == nil {
+		t.Fatalf("expected an error for a required secret backed by an unset environment variable")
+	}
+}
+
+func TestGetSecretMountSkipsOptionalSecretWithUnsetEnvVar(t *testing.T) {
+	const envVar = "BUILDAH_TEST_SECRET_VALUE_UNSET"
+	os.Unsetenv(envVar)
+
+	secrets := map[string]define.Secret{
+		"mysecret": {SourceType: "env", Source: envVar},
+	}
+
+	mount, mounted, cleanup, err := GetSecretMount([]string{"type=secret", "id=mysecret"}, secrets, t.TempDir())
+	if err != nil {
+		t.Fatalf("GetSecretMount: %v", err)
+	}
+	if mounted {
+		t.Fatalf("expected mounted=false for an optional secret backed by an unset environment variable")
+	}
+	if cleanup != nil {
+		t.Fatalf("expected a nil cleanup for a secret that wasn't mounted")
+	}
+	if mount.Source != "" {
+		t.Fatalf("expected an empty mount for a secret that wasn't mounted")
+	}
+}
+
+func TestGetSSHMountRequiresKnownID(t *testing.T) {
+	if _, _, err := GetSSHMount([]string{"type=ssh", "id=missing"}, 0, nil, t.TempDir()); err == nil {
+		t.Fatalf("expected an error for an ssh id with no matching source")
+	}
+}
+
+func TestGetSSHMountForwardsExistingSocket(t *testing.T) {
+	sources := map[string]*SSHSource{
+		"default": {Socket: "/tmp/some.sock"},
+	}
+
+	mount, cleanup, err := GetSSHMount([]string{"type=ssh"}, 3, sources, t.TempDir())
+	if err != nil {
+		t.Fatalf("GetSSHMount: %v", err)
+	}
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if mount.Source != "/tmp/some.sock" {
+		t.Fatalf("expected forwarded socket path, got %q", mount.Source)
+	}
+	if mount.Destination != "/run/buildkit/ssh_agent.3" {
+		t.Fatalf("expected default indexed destination, got %q", mount.Destination)
+	}
+}
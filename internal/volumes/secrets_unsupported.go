@@ -0,0 +1,19 @@
+//go:build !linux
+
+package volumes
+
+import (
+	"fmt"
+	"os"
+)
+
+// stageSecretTmpfs falls back to a plain staging directory on platforms
+// without Linux's tmpfs; the returned cleanup still removes it promptly
+// once the caller is done with it.
+func stageSecretTmpfs(tmpDir string) (string, func() error, error) {
+	dir, err := os.MkdirTemp(tmpDir, "buildah-secret")
+	if err != nil {
+		return "", nil, fmt.Errorf("creating secret staging directory: %w", err)
+	}
+	return dir, func() error { return os.RemoveAll(dir) }, nil
+}
@@ -0,0 +1,268 @@
+package volumes
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// SecureMountTarget safely resolves the in-container path destination
+// against the already-populated container rootfs, guarding against a
+// TOCTOU symlink swap between when we validate the path and when the
+// runtime actually calls mount(2) on it (the class of attack behind
+// CVE-2021-30465): a path that contains attacker-controlled content (a
+// shared volume, or layer contents from an untrusted image) could have one
+// of its components replaced with a symlink pointing outside rootfs in
+// that window, causing the host's "/" to end up bind-mounted into the
+// container instead of the intended destination.
+//
+// Where the kernel supports it, the whole walk is delegated to
+// openat2(RESOLVE_IN_ROOT | RESOLVE_NO_MAGICLINKS | RESOLVE_NO_XDEV), which
+// the kernel guarantees can't resolve outside of rootfs no matter what a
+// concurrent writer does to the path. On older kernels, we fall back to a
+// manual per-component walk that opens each component with O_NOFOLLOW,
+// resolving a component that turns out to be a symlink by splicing its
+// target back into the walk (confined to rootfs the same way) rather than
+// rejecting it outright, so a destination that's fine on a recent kernel
+// doesn't start failing purely because of which resolution path ran.
+//
+// Either way, the returned *os.File is an O_PATH descriptor on the
+// resolved destination, already verified to be inside rootfs. Callers
+// should hand the runtime "/proc/self/fd/<fd>" (via MagicLinkPath) as the
+// mount target instead of a string path, since the kernel guarantees that
+// magic-link keeps referring to the same inode even if the path is
+// rewritten again afterwards, and must Close() the returned file once the
+// mount has been established.
+func SecureMountTarget(rootfs, destination string) (*os.File, error) {
+	rootDir, err := os.OpenFile(rootfs, unix.O_PATH|unix.O_CLOEXEC|unix.O_DIRECTORY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("opening container rootfs %q: %w", rootfs, err)
+	}
+	defer rootDir.Close()
+
+	relative := strings.TrimPrefix(filepath.Clean(string(filepath.Separator)+destination), string(filepath.Separator))
+
+	if relative == "" {
+		// destination is rootfs's own root: there's no component to walk,
+		// so resolve it as "." relative to rootDir instead of handing back
+		// rootDir itself, which belongs to this function and is closed by
+		// the defer above before the caller ever sees it.
+		fd, err := unix.Openat(int(rootDir.Fd()), ".", unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return nil, fmt.Errorf("resolving mount destination %q: %w", destination, err)
+		}
+		return os.NewFile(uintptr(fd), rootfs), nil
+	}
+
+	resolved, err := secureMountTargetOpenat2(rootDir, relative)
+	if err == nil {
+		return resolved, nil
+	}
+	if !errors.Is(err, unix.ENOSYS) && !errors.Is(err, unix.EINVAL) {
+		return nil, err
+	}
+
+	return secureMountTargetFallback(rootDir, rootfs, relative)
+}
+
+// SecureMkdirAll creates destination, and any missing parent components,
+// inside rootfs: each missing component is created and then reopened with
+// O_NOFOLLOW before moving on to the next, so a concurrent symlink swap
+// can't redirect the mkdir outside of rootfs. Unlike SecureMountTarget, it
+// doesn't follow symlinks at all: a component that is a symlink is opened
+// as the link itself, so creating anything beneath it fails, even when the
+// link points inside rootfs. Most --mount destinations (e.g. /root/.cache) don't
+// already exist in a fresh image layer, and a plain
+// filepath.Join(rootfs, destination) + os.MkdirAll would reopen the exact
+// TOCTOU window this package exists to close, so callers should use this
+// instead to create a mount's destination before resolving it with
+// SecureMountTarget.
+func SecureMkdirAll(rootfs, destination string, mode os.FileMode) error {
+	rootDir, err := os.OpenFile(rootfs, unix.O_PATH|unix.O_CLOEXEC|unix.O_DIRECTORY, 0)
+	if err != nil {
+		return fmt.Errorf("opening container rootfs %q: %w", rootfs, err)
+	}
+	defer rootDir.Close()
+
+	relative := strings.TrimPrefix(filepath.Clean(string(filepath.Separator)+destination), string(filepath.Separator))
+	if relative == "" {
+		return nil
+	}
+
+	current := rootDir
+	ownCurrent := false
+	defer func() {
+		if ownCurrent {
+			current.Close()
+		}
+	}()
+
+	for _, component := range strings.Split(relative, "/") {
+		if component == "" || component == "." {
+			continue
+		}
+		if component == ".." {
+			return fmt.Errorf("rejecting mount destination %q: traverses out of rootfs", relative)
+		}
+		if err := unix.Mkdirat(int(current.Fd()), component, uint32(mode.Perm())); err != nil && err != unix.EEXIST {
+			return fmt.Errorf("creating mount destination component %q: %w", component, err)
+		}
+		fd, err := unix.Openat(int(current.Fd()), component, unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("resolving mount destination component %q: %w", component, err)
+		}
+		next := os.NewFile(uintptr(fd), component)
+		if ownCurrent {
+			current.Close()
+		}
+		current = next
+		ownCurrent = true
+	}
+	return nil
+}
+
+// MagicLinkPath returns the /proc/self/fd magic-link path for an *os.File
+// returned by SecureMountTarget, suitable for use as a runtime-spec mount
+// target: the kernel guarantees it keeps referring to the same inode even
+// if the original path is rewritten after resolution.
+func MagicLinkPath(resolved *os.File) string {
+	return fmt.Sprintf("/proc/self/fd/%d", resolved.Fd())
+}
+
+func secureMountTargetOpenat2(rootDir *os.File, relative string) (*os.File, error) {
+	how := unix.OpenHow{
+		Flags:   unix.O_PATH | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_IN_ROOT | unix.RESOLVE_NO_MAGICLINKS | unix.RESOLVE_NO_XDEV,
+	}
+	fd, err := unix.Openat2(int(rootDir.Fd()), relative, &how)
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), relative), nil
+}
+
+// maxFallbackSymlinks bounds how many symlinks secureMountTargetFallback
+// will follow while resolving a single destination, matching the kernel's
+// own MAXSYMLINKS limit, so a symlink loop fails with a clear error instead
+// of spinning forever.
+const maxFallbackSymlinks = 40
+
+// secureMountTargetFallback walks relative one component at a time,
+// starting from rootDir, opening each with O_NOFOLLOW. O_PATH|O_NOFOLLOW on
+// a symlink doesn't fail (the kernel happily hands back an O_PATH
+// descriptor for the symlink itself), so whether a component is a symlink
+// has to be determined with an explicit fstat rather than by checking the
+// open call's error. A component that turns out to be a symlink isn't
+// rejected outright: its target is read back (via readlinkat with an empty
+// path against the already-open symlink's own fd, valid for an fd opened
+// with O_PATH) and spliced into the remaining walk, so a symlink fully
+// contained within rootfs resolves the same way it would under the
+// openat2 fast path. An absolute symlink target restarts the walk from
+// rootDir (never from the host's real "/"), and a target that contains
+// ".." is rejected the same way a literal ".." component in the original
+// destination is. Once the final component is open, it reads back the
+// resolved path via /proc/self/fd and confirms it's still inside rootfs
+// before handing the descriptor back, closing the window for a swap that
+// happens after the last open but before this check.
+func secureMountTargetFallback(rootDir *os.File, rootfs, relative string) (*os.File, error) {
+	current := rootDir
+	ownCurrent := false
+	defer func() {
+		if ownCurrent {
+			current.Close()
+		}
+	}()
+
+	remaining := strings.Split(relative, "/")
+	symlinksFollowed := 0
+	for len(remaining) > 0 {
+		component := remaining[0]
+		remaining = remaining[1:]
+		if component == "" || component == "." {
+			continue
+		}
+		if component == ".." {
+			return nil, fmt.Errorf("rejecting mount destination %q: traverses out of rootfs", relative)
+		}
+
+		fd, err := unix.Openat(int(current.Fd()), component, unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return nil, fmt.Errorf("resolving mount destination component %q: %w", component, err)
+		}
+		opened := os.NewFile(uintptr(fd), component)
+
+		var stat unix.Stat_t
+		if err := unix.Fstat(int(opened.Fd()), &stat); err != nil {
+			opened.Close()
+			return nil, fmt.Errorf("statting mount destination component %q: %w", component, err)
+		}
+		if stat.Mode&unix.S_IFMT != unix.S_IFLNK {
+			if ownCurrent {
+				current.Close()
+			}
+			current = opened
+			ownCurrent = true
+			continue
+		}
+
+		symlinksFollowed++
+		if symlinksFollowed > maxFallbackSymlinks {
+			opened.Close()
+			return nil, fmt.Errorf("rejecting mount destination %q: too many levels of symbolic links", relative)
+		}
+		target, err := readlinkat(int(opened.Fd()), "")
+		opened.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading symlink mount destination component %q: %w", component, err)
+		}
+		if strings.HasPrefix(target, string(filepath.Separator)) {
+			// an absolute target is still confined to rootfs: restart the
+			// walk from rootDir, never from the host's own "/"
+			if ownCurrent {
+				current.Close()
+			}
+			current = rootDir
+			ownCurrent = false
+		}
+		// deliberately not filepath.Clean'd: that would silently collapse
+		// a leading ".." against our synthetic separator instead of
+		// leaving it for the ".." rejection above to catch on the next
+		// iteration
+		targetRelative := strings.TrimPrefix(target, string(filepath.Separator))
+		remaining = append(strings.Split(targetRelative, "/"), remaining...)
+	}
+
+	resolvedPath, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", current.Fd()))
+	if err != nil {
+		return nil, fmt.Errorf("reading back resolved mount destination: %w", err)
+	}
+	rootfsPrefix := filepath.Clean(rootfs) + string(filepath.Separator)
+	if resolvedPath != filepath.Clean(rootfs) && !strings.HasPrefix(resolvedPath, rootfsPrefix) {
+		return nil, fmt.Errorf("mount destination %q resolved to %q, outside of rootfs %q", relative, resolvedPath, rootfs)
+	}
+
+	ownCurrent = false
+	return current, nil
+}
+
+// readlinkat reads the target of the symlink named name within the
+// directory referenced by dirFd, growing its buffer until the whole target
+// fits. An empty name reads the target of the symlink referred to by dirFd
+// itself, which requires dirFd to have been opened with O_PATH.
+func readlinkat(dirFd int, name string) (string, error) {
+	for size := 256; size <= 64*1024; size *= 4 {
+		buf := make([]byte, size)
+		n, err := unix.Readlinkat(dirFd, name, buf)
+		if err != nil {
+			return "", err
+		}
+		if n < size {
+			return string(buf[:n]), nil
+		}
+	}
+	return "", fmt.Errorf("symlink target of %q is too long", name)
+}
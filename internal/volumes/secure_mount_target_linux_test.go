@@ -0,0 +1,218 @@
+package volumes
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestSecureMountTargetResolvesInsideRootfs(t *testing.T) {
+	rootfs := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(rootfs, "a", "b"), 0o755); err != nil {
+		t.Fatalf("creating fixture directory: %v", err)
+	}
+
+	resolved, err := SecureMountTarget(rootfs, "/a/b")
+	if err != nil {
+		t.Fatalf("SecureMountTarget: %v", err)
+	}
+	defer resolved.Close()
+
+	if got := MagicLinkPath(resolved); got == "" {
+		t.Fatalf("MagicLinkPath returned an empty path")
+	}
+}
+
+func TestSecureMountTargetRejectsSymlinkEscape(t *testing.T) {
+	rootfs := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(rootfs, "escape")); err != nil {
+		t.Fatalf("creating escape symlink: %v", err)
+	}
+
+	if resolved, err := SecureMountTarget(rootfs, "/escape/whatever"); err == nil {
+		resolved.Close()
+		t.Fatalf("expected SecureMountTarget to reject a destination behind a symlink that escapes rootfs")
+	}
+}
+
+func TestSecureMountTargetCleansDotDotWithinRootfs(t *testing.T) {
+	rootfs := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(rootfs, "a"), 0o755); err != nil {
+		t.Fatalf("creating fixture directory: %v", err)
+	}
+
+	// "/a/../a" cleans down to "/a", which stays inside rootfs and should
+	// resolve like any other in-bounds destination.
+	resolved, err := SecureMountTarget(rootfs, "/a/../a")
+	if err != nil {
+		t.Fatalf("SecureMountTarget: %v", err)
+	}
+	resolved.Close()
+}
+
+func TestSecureMountTargetResolvesRootfsRootItself(t *testing.T) {
+	rootfs := t.TempDir()
+
+	// destination "/" resolves to zero path components; SecureMountTarget
+	// must not hand back its own internal rootDir descriptor, which it
+	// closes via defer before returning.
+	resolved, err := SecureMountTarget(rootfs, "/")
+	if err != nil {
+		t.Fatalf("SecureMountTarget: %v", err)
+	}
+	defer resolved.Close()
+
+	if _, err := os.Stat(MagicLinkPath(resolved)); err != nil {
+		t.Fatalf("resolved descriptor is not usable: %v", err)
+	}
+}
+
+// assertSameInode fails the test unless path and resolved refer to the same
+// inode, so a test can't pass merely because resolving a symlink returned
+// *some* descriptor without checking it's the target rather than the
+// symlink entry itself.
+func assertSameInode(t *testing.T, resolved *os.File, path string) {
+	t.Helper()
+	var resolvedStat, wantStat unix.Stat_t
+	if err := unix.Fstat(int(resolved.Fd()), &resolvedStat); err != nil {
+		t.Fatalf("statting resolved descriptor: %v", err)
+	}
+	if err := unix.Stat(path, &wantStat); err != nil {
+		t.Fatalf("statting %q: %v", path, err)
+	}
+	if resolvedStat.Dev != wantStat.Dev || resolvedStat.Ino != wantStat.Ino {
+		t.Fatalf("resolved descriptor refers to a different inode than %q: got dev/ino %d/%d, want %d/%d", path, resolvedStat.Dev, resolvedStat.Ino, wantStat.Dev, wantStat.Ino)
+	}
+}
+
+// TestSecureMountTargetFallbackResolvesInBoundsSymlink exercises
+// secureMountTargetFallback directly (bypassing the openat2 fast path,
+// which isn't guaranteed to be taken on every kernel this runs on) to
+// confirm a symlink fully contained within rootfs resolves to its target,
+// not to the symlink entry itself, rather than being rejected outright.
+func TestSecureMountTargetFallbackResolvesInBoundsSymlink(t *testing.T) {
+	rootfs := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(rootfs, "real"), 0o755); err != nil {
+		t.Fatalf("creating fixture directory: %v", err)
+	}
+	if err := os.Symlink("real", filepath.Join(rootfs, "link")); err != nil {
+		t.Fatalf("creating in-bounds symlink: %v", err)
+	}
+
+	rootDir, err := os.OpenFile(rootfs, unix.O_PATH|unix.O_CLOEXEC|unix.O_DIRECTORY, 0)
+	if err != nil {
+		t.Fatalf("opening rootfs: %v", err)
+	}
+	defer rootDir.Close()
+
+	resolved, err := secureMountTargetFallback(rootDir, rootfs, "link")
+	if err != nil {
+		t.Fatalf("secureMountTargetFallback: expected an in-bounds symlink to resolve, got: %v", err)
+	}
+	defer resolved.Close()
+	assertSameInode(t, resolved, filepath.Join(rootfs, "real"))
+}
+
+// TestSecureMountTargetFallbackResolvesAbsoluteInBoundsSymlink confirms an
+// absolute symlink target is resolved relative to rootDir, as a contained
+// process would see it, rather than against the host's real "/", and that
+// the resolved descriptor refers to the target, not the symlink entry.
+func TestSecureMountTargetFallbackResolvesAbsoluteInBoundsSymlink(t *testing.T) {
+	rootfs := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(rootfs, "real"), 0o755); err != nil {
+		t.Fatalf("creating fixture directory: %v", err)
+	}
+	if err := os.Symlink("/real", filepath.Join(rootfs, "link")); err != nil {
+		t.Fatalf("creating absolute in-bounds symlink: %v", err)
+	}
+
+	rootDir, err := os.OpenFile(rootfs, unix.O_PATH|unix.O_CLOEXEC|unix.O_DIRECTORY, 0)
+	if err != nil {
+		t.Fatalf("opening rootfs: %v", err)
+	}
+	defer rootDir.Close()
+
+	resolved, err := secureMountTargetFallback(rootDir, rootfs, "link")
+	if err != nil {
+		t.Fatalf("secureMountTargetFallback: expected an absolute in-bounds symlink to resolve, got: %v", err)
+	}
+	defer resolved.Close()
+	assertSameInode(t, resolved, filepath.Join(rootfs, "real"))
+}
+
+// TestSecureMountTargetFallbackResolvesIntermediateSymlink confirms that a
+// symlink in the *middle* of the destination (e.g. a merged-/usr-style
+// "/var/run -> /run" layout) is followed rather than causing the next
+// Openat in the walk to fail.
+func TestSecureMountTargetFallbackResolvesIntermediateSymlink(t *testing.T) {
+	rootfs := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(rootfs, "run", "sub"), 0o755); err != nil {
+		t.Fatalf("creating fixture directory: %v", err)
+	}
+	if err := os.Symlink("run", filepath.Join(rootfs, "var")); err != nil {
+		t.Fatalf("creating intermediate in-bounds symlink: %v", err)
+	}
+
+	rootDir, err := os.OpenFile(rootfs, unix.O_PATH|unix.O_CLOEXEC|unix.O_DIRECTORY, 0)
+	if err != nil {
+		t.Fatalf("opening rootfs: %v", err)
+	}
+	defer rootDir.Close()
+
+	resolved, err := secureMountTargetFallback(rootDir, rootfs, "var/sub")
+	if err != nil {
+		t.Fatalf("secureMountTargetFallback: expected an intermediate in-bounds symlink to resolve, got: %v", err)
+	}
+	defer resolved.Close()
+	assertSameInode(t, resolved, filepath.Join(rootfs, "run", "sub"))
+}
+
+// TestSecureMountTargetFallbackRejectsSymlinkEscape is the fallback-path
+// counterpart of TestSecureMountTargetRejectsSymlinkEscape.
+func TestSecureMountTargetFallbackRejectsSymlinkEscape(t *testing.T) {
+	rootfs := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(rootfs, "escape")); err != nil {
+		t.Fatalf("creating escape symlink: %v", err)
+	}
+
+	rootDir, err := os.OpenFile(rootfs, unix.O_PATH|unix.O_CLOEXEC|unix.O_DIRECTORY, 0)
+	if err != nil {
+		t.Fatalf("opening rootfs: %v", err)
+	}
+	defer rootDir.Close()
+
+	if resolved, err := secureMountTargetFallback(rootDir, rootfs, "escape/whatever"); err == nil {
+		resolved.Close()
+		t.Fatalf("expected secureMountTargetFallback to reject a destination behind a symlink that escapes rootfs")
+	}
+}
+
+func TestSecureMkdirAllCreatesMissingComponents(t *testing.T) {
+	rootfs := t.TempDir()
+
+	if err := SecureMkdirAll(rootfs, "/root/.cache/pip", 0o755); err != nil {
+		t.Fatalf("SecureMkdirAll: %v", err)
+	}
+
+	resolved, err := SecureMountTarget(rootfs, "/root/.cache/pip")
+	if err != nil {
+		t.Fatalf("SecureMountTarget after SecureMkdirAll: %v", err)
+	}
+	resolved.Close()
+}
+
+func TestSecureMkdirAllRejectsSymlinkEscape(t *testing.T) {
+	rootfs := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(rootfs, "escape")); err != nil {
+		t.Fatalf("creating escape symlink: %v", err)
+	}
+
+	if err := SecureMkdirAll(rootfs, "/escape/whatever", 0o755); err == nil {
+		t.Fatalf("expected SecureMkdirAll to reject a destination behind a symlink that escapes rootfs")
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package volumes
+
+import (
+	"errors"
+	"os"
+)
+
+// SecureMountTarget is only implemented on Linux, where openat2(2) and
+// /proc/self/fd magic-links are available to close the TOCTOU window.
+func SecureMountTarget(rootfs, destination string) (*os.File, error) {
+	return nil, errors.New("secure mount target resolution is only supported on linux")
+}
+
+// MagicLinkPath is only meaningful alongside SecureMountTarget.
+func MagicLinkPath(resolved *os.File) string {
+	return resolved.Name()
+}
+
+// SecureMkdirAll is only implemented on Linux, alongside SecureMountTarget.
+func SecureMkdirAll(rootfs, destination string, mode os.FileMode) error {
+	return errors.New("secure mount destination creation is only supported on linux")
+}
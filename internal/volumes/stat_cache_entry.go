@@ -0,0 +1,37 @@
+package volumes
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// statCacheEntry returns the total size in bytes of the cache entry rooted
+// at path (the sum of its regular files' apparent sizes, if it's a
+// directory; allocated blocks aren't counted), along with its access and
+// creation times as used for eviction ordering by EnforceCacheQuota.
+func statCacheEntry(path string) (size, atime, ctime int64, err error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	a, c := fileAccessAndCreateTimes(info)
+	atime, ctime = a, c
+
+	if !info.Mode().IsDir() {
+		return info.Size(), atime, ctime, nil
+	}
+
+	err = filepath.Walk(path, func(_ string, walkInfo os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			// best-effort: a file disappearing mid-walk shouldn't abort
+			// the whole quota check
+			return nil
+		}
+		if walkInfo.Mode().IsRegular() {
+			size += walkInfo.Size()
+		}
+		return nil
+	})
+	return size, atime, ctime, err
+}
@@ -0,0 +1,17 @@
+package volumes
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileAccessAndCreateTimes extracts atime and ctime (Linux has no true
+// creation time, so ctime is used as the next best thing for "fifo"
+// eviction ordering) from a Stat_t, falling back to ModTime if the
+// underlying Sys() isn't a *syscall.Stat_t.
+func fileAccessAndCreateTimes(info os.FileInfo) (atime, ctime int64) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Atim.Sec, st.Ctim.Sec
+	}
+	return info.ModTime().Unix(), info.ModTime().Unix()
+}
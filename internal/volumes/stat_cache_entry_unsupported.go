@@ -0,0 +1,11 @@
+//go:build !linux
+
+package volumes
+
+import "os"
+
+// fileAccessAndCreateTimes falls back to ModTime on platforms where we
+// don't special-case extracting atime/ctime from Sys().
+func fileAccessAndCreateTimes(info os.FileInfo) (atime, ctime int64) {
+	return info.ModTime().Unix(), info.ModTime().Unix()
+}
@@ -0,0 +1,63 @@
+package volumes
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGetTmpfsMountRequiresDestination(t *testing.T) {
+	if _, err := GetTmpfsMount([]string{"type=tmpfs"}, "/work"); err == nil {
+		t.Fatalf("expected an error for a missing target")
+	}
+}
+
+func TestGetTmpfsMountRejectsSource(t *testing.T) {
+	if _, err := GetTmpfsMount([]string{"type=tmpfs", "src=/whatever", "target=/data"}, "/work"); err == nil {
+		t.Fatalf("expected an error for a tmpfs mount with a source")
+	}
+}
+
+func TestGetTmpfsMountRejectsConflictingOptions(t *testing.T) {
+	conflicts := [][]string{
+		{"type=tmpfs", "target=/data", "ro", "rw"},
+		{"type=tmpfs", "target=/data", "suid", "nosuid"},
+		{"type=tmpfs", "target=/data", "dev", "nodev"},
+		{"type=tmpfs", "target=/data", "exec", "noexec"},
+		{"type=tmpfs", "target=/data", "tmpcopyup", "notmpcopyup"},
+	}
+	for _, args := range conflicts {
+		if _, err := GetTmpfsMount(args, "/work"); err == nil {
+			t.Errorf("expected an error for conflicting options in %v", args)
+		}
+	}
+}
+
+func TestGetTmpfsMountCancelsDefaultsWithExplicitOptions(t *testing.T) {
+	mount, err := GetTmpfsMount([]string{"type=tmpfs", "target=/data", "suid", "dev", "exec"}, "/work")
+	if err != nil {
+		t.Fatalf("GetTmpfsMount: %v", err)
+	}
+	for _, unwanted := range []string{"nosuid", "nodev", "noexec"} {
+		if slices.Contains(mount.Options, unwanted) {
+			t.Errorf("did not expect %q among %v once the caller explicitly asked for the opposite", unwanted, mount.Options)
+		}
+	}
+	for _, wanted := range []string{"suid", "dev", "exec"} {
+		if !slices.Contains(mount.Options, wanted) {
+			t.Errorf("expected %q among %v", wanted, mount.Options)
+		}
+	}
+}
+
+func TestGetTmpfsMountTmpfsModeAndSize(t *testing.T) {
+	mount, err := GetTmpfsMount([]string{"type=tmpfs", "target=/data", "tmpfs-mode=1700", "tmpfs-size=100m"}, "/work")
+	if err != nil {
+		t.Fatalf("GetTmpfsMount: %v", err)
+	}
+	if !slices.Contains(mount.Options, "mode=1700") {
+		t.Errorf("expected mode=1700 among %v", mount.Options)
+	}
+	if !slices.Contains(mount.Options, "size=100m") {
+		t.Errorf("expected size=100m among %v", mount.Options)
+	}
+}
@@ -35,6 +35,16 @@ const (
 	TypeTmpfs = "tmpfs"
 	// TypeCache is the type for mounting a common persistent cache from host
 	TypeCache = "cache"
+	// TypeImage is the type for mounting another image's root filesystem
+	TypeImage = "image"
+	// TypeVolume is the type for mounting a managed named volume
+	TypeVolume = "volume"
+	// TypeSecret is the type for mounting a build secret
+	TypeSecret = "secret"
+	// TypeSSH is the type for forwarding an SSH agent socket
+	TypeSSH = "ssh"
+	// TypeDevpts is the type for mounting a fresh devpts instance
+	TypeDevpts = "devpts"
 	// mount=type=cache must create a persistent directory on host so its available for all consecutive builds.
 	// Lifecycle of following directory will be inherited from how host machine treats temporary directory
 	buildahCacheDir = "buildah-cache"
@@ -43,6 +53,10 @@ const (
 	// All the lockfiles are stored in a separate directory inside `BuildahCacheDir`
 	// Example `/var/tmp/buildah-cache/<target>/buildah-cache-lockfile`
 	BuildahCacheLockfileDir = "buildah-cache-lockfiles"
+	// mount=type=volume persists its contents across builds and invocations,
+	// independently of any single Dockerfile stage, under a directory
+	// separate from the ad-hoc build cache.
+	buildahVolumeDir = "buildah-volumes"
 )
 
 var (
@@ -53,11 +67,33 @@ var (
 	errDuplicateDest = errors.New("duplicate mount destination")
 )
 
+// SupportedMountTypes lists every type= value accepted by the --mount flag,
+// so that callers (including this
+// package's own parser error messages) don't need to be kept in sync with
+// the list by hand.
+var SupportedMountTypes = []string{
+	define.TypeBind,
+	TypeImage,
+	TypeVolume,
+	TypeCache,
+	TypeTmpfs,
+	TypeDevpts,
+	TypeSecret,
+	TypeSSH,
+}
+
 // CacheParent returns a cache parent for --mount=type=cache
 func CacheParent() string {
 	return filepath.Join(tmpdir.GetTempDir(), buildahCacheDir+"-"+strconv.Itoa(unshare.GetRootlessUID()))
 }
 
+// VolumeParent returns the parent directory for named volumes created with
+// --mount=type=volume. Unlike the cache parent, entries here are keyed by
+// volume name and are expected to outlive any single build.
+func VolumeParent() string {
+	return filepath.Join(tmpdir.GetTempDir(), buildahVolumeDir+"-"+strconv.Itoa(unshare.GetRootlessUID()))
+}
+
 func mountIsReadWrite(m specs.Mount) bool {
 	// in case of conflicts, the last one wins, so it's not enough
 	// to check for the presence of either "rw" or "ro" anywhere
@@ -74,6 +110,34 @@ func mountIsReadWrite(m specs.Mount) bool {
 	return rw
 }
 
+// resolveSecureDestination closes the CVE-2021-30465-class TOCTOU window
+// described on SecureMountTarget by resolving destination against rootfs
+// (when the caller has one available, i.e. once the container's rootfs is
+// actually mounted) and handing back the /proc/self/fd magic-link path
+// instead of the original string, plus a cleanup that must be run once the
+// runtime has finished establishing the mount, to close the held
+// descriptor. If rootfs is empty (no container rootfs is available yet,
+// e.g. while merely validating --mount/--volume syntax), destination is
+// returned unchanged.
+func resolveSecureDestination(rootfs, destination string) (string, func() error, error) {
+	if rootfs == "" {
+		return destination, nil, nil
+	}
+	// most --mount destinations (e.g. /root/.cache) don't already exist in
+	// a fresh image layer; create them through the same rootfs-confined
+	// walk SecureMountTarget itself uses, instead of a plain
+	// filepath.Join(rootfs, destination) + os.MkdirAll, which would reopen
+	// the TOCTOU window this function exists to close.
+	if err := SecureMkdirAll(rootfs, destination, 0o755); err != nil {
+		return "", nil, fmt.Errorf("creating mount destination %q: %w", destination, err)
+	}
+	resolved, err := SecureMountTarget(rootfs, destination)
+	if err != nil {
+		return "", nil, fmt.Errorf("resolving mount destination %q: %w", destination, err)
+	}
+	return MagicLinkPath(resolved), resolved.Close, nil
+}
+
 func convertToOverlay(m specs.Mount, store storage.Store, mountLabel, tmpDir string, uid, gid int) (specs.Mount, string, error) {
 	overlayDir, err := overlay.TempDir(tmpDir, uid, gid)
 	if err != nil {
@@ -129,6 +193,9 @@ func GetBindMount(sys *types.SystemContext, args []string, contextDir string, st
 	setDest := ""
 	bindNonRecursive := false
 	fromImage := ""
+	foundSuid, foundNosuid := false, false
+	foundDev, foundNodev := false, false
+	foundExec, foundNoexec := false, false
 
 	for _, val := range args {
 		argName, argValue, hasArgValue := strings.Cut(val, "=")
@@ -139,10 +206,42 @@ func GetBindMount(sys *types.SystemContext, args []string, contextDir string, st
 		case "bind-nonrecursive":
 			newMount.Options = append(newMount.Options, "bind")
 			bindNonRecursive = true
-		case "nosuid", "nodev", "noexec":
-			// TODO: detect duplication of these options.
-			// (Is this necessary?)
-			newMount.Options = append(newMount.Options, argName)
+		case "nosuid":
+			if foundSuid {
+				return newMount, "", "", fmt.Errorf("cannot set both 'suid' and 'nosuid': %w", errBadMntOption)
+			}
+			foundNosuid = true
+			newMount.Options = append(newMount.Options, "nosuid")
+		case "suid":
+			if foundNosuid {
+				return newMount, "", "", fmt.Errorf("cannot set both 'suid' and 'nosuid': %w", errBadMntOption)
+			}
+			foundSuid = true
+			newMount.Options = append(newMount.Options, "suid")
+		case "nodev":
+			if foundDev {
+				return newMount, "", "", fmt.Errorf("cannot set both 'dev' and 'nodev': %w", errBadMntOption)
+			}
+			foundNodev = true
+			newMount.Options = append(newMount.Options, "nodev")
+		case "dev":
+			if foundNodev {
+				return newMount, "", "", fmt.Errorf("cannot set both 'dev' and 'nodev': %w", errBadMntOption)
+			}
+			foundDev = true
+			newMount.Options = append(newMount.Options, "dev")
+		case "noexec":
+			if foundExec {
+				return newMount, "", "", fmt.Errorf("cannot set both 'exec' and 'noexec': %w", errBadMntOption)
+			}
+			foundNoexec = true
+			newMount.Options = append(newMount.Options, "noexec")
+		case "exec":
+			if foundNoexec {
+				return newMount, "", "", fmt.Errorf("cannot set both 'exec' and 'noexec': %w", errBadMntOption)
+			}
+			foundExec = true
+			newMount.Options = append(newMount.Options, "exec")
 		case "rw", "readwrite":
 			newMount.Options = append(newMount.Options, "rw")
 			mountReadability = "rw"
@@ -154,6 +253,21 @@ func GetBindMount(sys *types.SystemContext, args []string, contextDir string, st
 				return newMount, "", "", fmt.Errorf("%v: %w", val, errBadOptionArg)
 			}
 			newMount.Options = append(newMount.Options, argName)
+		case "chown":
+			// friendlier alias for "U": chown the mount to the effective
+			// UID/GID of the container's run configuration once it's mounted
+			value := true
+			if hasArgValue {
+				var err error
+				if value, err = strconv.ParseBool(argValue); err != nil {
+					return newMount, "", "", fmt.Errorf("unable to parse value of %q: %w", argName, err)
+				}
+			}
+			if value {
+				newMount.Options = append(newMount.Options, "U")
+			}
+		case "idmap":
+			newMount.Options = append(newMount.Options, "idmap")
 		case "from":
 			if !hasArgValue {
 				return newMount, "", "", fmt.Errorf("%v: %w", argName, errBadOptionArg)
@@ -278,6 +392,30 @@ func GetBindMount(sys *types.SystemContext, args []string, contextDir string, st
 		}
 	}
 
+	// buildkit/docker parity: a bind mount inherits nosuid/nodev/noexec
+	// from the source filesystem's own mount flags unless the caller
+	// explicitly overrode them above. ro isn't handled here: the default
+	// mount readability above is already unconditionally "ro" whenever the
+	// caller didn't ask for "rw", so there's nothing left to inherit.
+	if inherited, err := defaultMountOptsFor(newMount.Source); err == nil {
+		for _, opt := range inherited {
+			switch opt {
+			case "nosuid":
+				if !foundSuid && !foundNosuid {
+					newMount.Options = append(newMount.Options, "nosuid")
+				}
+			case "nodev":
+				if !foundDev && !foundNodev {
+					newMount.Options = append(newMount.Options, "nodev")
+				}
+			case "noexec":
+				if !foundExec && !foundNoexec {
+					newMount.Options = append(newMount.Options, "noexec")
+				}
+			}
+		}
+	}
+
 	opts, err := parse.ValidateVolumeOpts(newMount.Options)
 	if err != nil {
 		return newMount, "", "", err
@@ -296,10 +434,142 @@ func GetBindMount(sys *types.SystemContext, args []string, contextDir string, st
 	return newMount, mountedImage, overlayDir, nil
 }
 
+// GetImageMount parses a single image mount entry from the --mount flag.
+// Returns specifiedMount and a string which contains name of image that we mounted otherwise its empty.
+// Caller is expected to perform unmount of any mounted images
+func GetImageMount(sys *types.SystemContext, args []string, store storage.Store, mountLabel string, additionalMountPoints map[string]internal.StageMountDetails, workDir, tmpDir string) (specs.Mount, string, string, error) {
+	newMount := specs.Mount{
+		Type: define.TypeBind,
+	}
+
+	setDest := ""
+	fromImage := ""
+	subpath := ""
+	rw := false
+
+	for _, val := range args {
+		argName, argValue, hasArgValue := strings.Cut(val, "=")
+		switch argName {
+		case "type":
+			// This is already processed
+			continue
+		case "src", "source":
+			if !hasArgValue {
+				return newMount, "", "", fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			fromImage = argValue
+		case "target", "dst", "destination":
+			if !hasArgValue {
+				return newMount, "", "", fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			targetPath := argValue
+			setDest = targetPath
+			if !path.IsAbs(targetPath) {
+				targetPath = filepath.Join(workDir, targetPath)
+			}
+			if err := parse.ValidateVolumeCtrDir(targetPath); err != nil {
+				return newMount, "", "", err
+			}
+			newMount.Destination = targetPath
+		case "rw", "readwrite":
+			if !hasArgValue {
+				rw = true
+				continue
+			}
+			value, err := strconv.ParseBool(argValue)
+			if err != nil {
+				return newMount, "", "", fmt.Errorf("%v: %w", val, errBadMntOption)
+			}
+			rw = value
+		case "subpath":
+			if !hasArgValue {
+				return newMount, "", "", fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			subpath = argValue
+		default:
+			return newMount, "", "", fmt.Errorf("%v: %w", argName, errBadMntOption)
+		}
+	}
+
+	if setDest == "" {
+		return newMount, "", "", errBadVolDest
+	}
+	if fromImage == "" {
+		return newMount, "", "", errBadVolSrc
+	}
+
+	mountPoint := ""
+	if additionalMountPoints != nil {
+		if val, ok := additionalMountPoints[fromImage]; ok && val.IsImage {
+			mountPoint = val.MountPoint
+		}
+	}
+
+	// Following variable ensures that we return imagename only if we mounted the image ourselves
+	succeeded := false
+	mountedImage := ""
+	if mountPoint == "" {
+		image, err := internalUtil.LookupImage(sys, store, fromImage)
+		if err != nil {
+			return newMount, "", "", err
+		}
+
+		mountPoint, err = image.Mount(context.Background(), nil, mountLabel)
+		if err != nil {
+			return newMount, "", "", err
+		}
+		mountedImage = image.ID()
+		defer func() {
+			if !succeeded {
+				if _, err := store.UnmountImage(mountedImage, false); err != nil {
+					logrus.Debugf("unmounting image-mounted image %q: %v", fromImage, err)
+				}
+			}
+		}()
+	}
+
+	newMount.Source = mountPoint
+	if subpath != "" {
+		evaluated, err := copier.Eval(mountPoint, mountPoint+string(filepath.Separator)+subpath, copier.EvalOptions{})
+		if err != nil {
+			return newMount, "", "", err
+		}
+		newMount.Source = evaluated
+	}
+
+	if rw {
+		newMount.Options = []string{"rbind", "rw"}
+	} else {
+		newMount.Options = []string{"rbind", "ro"}
+	}
+
+	opts, err := parse.ValidateVolumeOpts(newMount.Options)
+	if err != nil {
+		return newMount, "", "", err
+	}
+	newMount.Options = opts
+
+	overlayDir := ""
+	if rw {
+		// changes to a read-write image mount are discarded on unmount, same
+		// as a read-write bind mount of an image root
+		if newMount, overlayDir, err = convertToOverlay(newMount, store, mountLabel, tmpDir, 0, 0); err != nil {
+			return newMount, "", "", err
+		}
+	}
+
+	succeeded = true
+
+	return newMount, mountedImage, overlayDir, nil
+}
+
 // GetCacheMount parses a single cache mount entry from the --mount flag.
 //
-// If this function succeeds and returns a non-nil *lockfile.LockFile, the caller must unlock it (when??).
-func GetCacheMount(args []string, _ storage.Store, _ string, additionalMountPoints map[string]internal.StageMountDetails, workDir string) (specs.Mount, *lockfile.LockFile, error) {
+// If this function succeeds and returns a non-nil *lockfile.LockFile, the
+// caller must unlock it (when??). If it returns a non-empty overlay
+// directory, the caller must clean it up the same way it does for bind and
+// image mounts.
+func GetCacheMount(args []string, store storage.Store, mountLabel string, additionalMountPoints map[string]internal.StageMountDetails, workDir, tmpDir string) (specs.Mount, *lockfile.LockFile, string, error) {
 	var err error
 	var mode uint64
 	var buildahLockFilesDir string
@@ -323,6 +593,13 @@ func GetCacheMount(args []string, _ storage.Store, _ string, additionalMountPoin
 	gid := 0
 	// sharing mode
 	sharing := "shared"
+	// quota enforcement is opt-in: a zero max-size means "unbounded"
+	maxSize := int64(0)
+	eviction := "none"
+	// the on-disk directory name for this cache, set below once we know
+	// whether it's keyed by `id` or by destination; used for quota
+	// enforcement once we're holding the cache's lock exclusively
+	cacheDirID := ""
 
 	for _, val := range args {
 		argName, argValue, hasArgValue := strings.Cut(val, "=")
@@ -350,69 +627,87 @@ func GetCacheMount(args []string, _ storage.Store, _ string, additionalMountPoin
 			sharing = argValue
 		case "bind-propagation":
 			if !hasArgValue {
-				return newMount, nil, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+				return newMount, nil, "", fmt.Errorf("%v: %w", argName, errBadOptionArg)
 			}
 			switch argValue {
 			default:
-				return newMount, nil, fmt.Errorf("%v: %q: %w", argName, argValue, errBadMntOption)
+				return newMount, nil, "", fmt.Errorf("%v: %q: %w", argName, argValue, errBadMntOption)
 			case "shared", "rshared", "private", "rprivate", "slave", "rslave":
 				// this should be the relevant parts of the same list of options we accepted above
 			}
 			newMount.Options = append(newMount.Options, argValue)
 		case "id":
 			if !hasArgValue {
-				return newMount, nil, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+				return newMount, nil, "", fmt.Errorf("%v: %w", argName, errBadOptionArg)
 			}
 			id = argValue
 		case "from":
 			if !hasArgValue {
-				return newMount, nil, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+				return newMount, nil, "", fmt.Errorf("%v: %w", argName, errBadOptionArg)
 			}
 			fromStage = argValue
 		case "target", "dst", "destination":
 			if !hasArgValue {
-				return newMount, nil, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+				return newMount, nil, "", fmt.Errorf("%v: %w", argName, errBadOptionArg)
 			}
 			targetPath := argValue
 			if !path.IsAbs(targetPath) {
 				targetPath = filepath.Join(workDir, targetPath)
 			}
 			if err := parse.ValidateVolumeCtrDir(targetPath); err != nil {
-				return newMount, nil, err
+				return newMount, nil, "", err
 			}
 			newMount.Destination = targetPath
 			setDest = true
 		case "src", "source":
 			if !hasArgValue {
-				return newMount, nil, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+				return newMount, nil, "", fmt.Errorf("%v: %w", argName, errBadOptionArg)
 			}
 			newMount.Source = argValue
 		case "mode":
 			if !hasArgValue {
-				return newMount, nil, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+				return newMount, nil, "", fmt.Errorf("%v: %w", argName, errBadOptionArg)
 			}
 			mode, err = strconv.ParseUint(argValue, 8, 32)
 			if err != nil {
-				return newMount, nil, fmt.Errorf("unable to parse cache mode: %w", err)
+				return newMount, nil, "", fmt.Errorf("unable to parse cache mode: %w", err)
 			}
 		case "uid":
 			if !hasArgValue {
-				return newMount, nil, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+				return newMount, nil, "", fmt.Errorf("%v: %w", argName, errBadOptionArg)
 			}
 			uid, err = strconv.Atoi(argValue)
 			if err != nil {
-				return newMount, nil, fmt.Errorf("unable to parse cache uid: %w", err)
+				return newMount, nil, "", fmt.Errorf("unable to parse cache uid: %w", err)
 			}
 		case "gid":
 			if !hasArgValue {
-				return newMount, nil, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+				return newMount, nil, "", fmt.Errorf("%v: %w", argName, errBadOptionArg)
 			}
 			gid, err = strconv.Atoi(argValue)
 			if err != nil {
-				return newMount, nil, fmt.Errorf("unable to parse cache gid: %w", err)
+				return newMount, nil, "", fmt.Errorf("unable to parse cache gid: %w", err)
+			}
+		case "max-size":
+			if !hasArgValue {
+				return newMount, nil, "", fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			maxSize, err = parseCacheSize(argValue)
+			if err != nil {
+				return newMount, nil, "", fmt.Errorf("unable to parse cache max-size: %w", err)
+			}
+		case "eviction":
+			if !hasArgValue {
+				return newMount, nil, "", fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			switch argValue {
+			case "lru", "fifo", "none":
+				eviction = argValue
+			default:
+				return newMount, nil, "", fmt.Errorf("%v: %q: %w", argName, argValue, errBadMntOption)
 			}
 		default:
-			return newMount, nil, fmt.Errorf("%v: %w", argName, errBadMntOption)
+			return newMount, nil, "", fmt.Errorf("%v: %w", argName, errBadMntOption)
 		}
 	}
 
@@ -423,7 +718,7 @@ func GetCacheMount(args []string, _ storage.Store, _ string, additionalMountPoin
 	}
 
 	if !setDest {
-		return newMount, nil, errBadVolDest
+		return newMount, nil, "", errBadVolDest
 	}
 
 	if fromStage != "" {
@@ -438,12 +733,12 @@ func GetCacheMount(args []string, _ storage.Store, _ string, additionalMountPoin
 		// Cache does not support using an image so if there's no such
 		// stage or temporary directory, return an error
 		if mountPoint == "" {
-			return newMount, nil, fmt.Errorf("no stage or additional build context found with name %s", fromStage)
+			return newMount, nil, "", fmt.Errorf("no stage or additional build context found with name %s", fromStage)
 		}
 		// path should be /mountPoint/specified path
 		evaluated, err := copier.Eval(mountPoint, mountPoint+string(filepath.Separator)+newMount.Source, copier.EvalOptions{})
 		if err != nil {
-			return newMount, nil, err
+			return newMount, nil, "", err
 		}
 		newMount.Source = evaluated
 	} else {
@@ -458,19 +753,26 @@ func GetCacheMount(args []string, _ storage.Store, _ string, additionalMountPoin
 		// create cache on host if not present
 		err = os.MkdirAll(cacheParent, os.FileMode(0o755))
 		if err != nil {
-			return newMount, nil, fmt.Errorf("unable to create build cache directory: %w", err)
+			return newMount, nil, "", fmt.Errorf("unable to create build cache directory: %w", err)
 		}
 
+		// note: the on-disk directory is keyed the same way regardless of
+		// `sharing`, including "private": "private" gets its own
+		// copy-on-write overlay (below) of this same shared directory
+		// rather than a disconnected directory of its own, so it still
+		// benefits from whatever's already in the cache.
 		if id != "" {
 			// Don't let the user control where we place the directory.
 			dirID := digest.FromString(id).Encoded()[:16]
 			newMount.Source = filepath.Join(cacheParent, dirID)
 			buildahLockFilesDir = filepath.Join(BuildahCacheLockfileDir, dirID)
+			cacheDirID = dirID
 		} else {
 			// Don't let the user control where we place the directory.
 			dirID := digest.FromString(newMount.Destination).Encoded()[:16]
 			newMount.Source = filepath.Join(cacheParent, dirID)
 			buildahLockFilesDir = filepath.Join(BuildahCacheLockfileDir, dirID)
+			cacheDirID = dirID
 		}
 		idPair := idtools.IDPair{
 			UID: uid,
@@ -479,18 +781,19 @@ func GetCacheMount(args []string, _ storage.Store, _ string, additionalMountPoin
 		// buildkit parity: change uid and gid if specified, otherwise keep `0`
 		err = idtools.MkdirAllAndChownNew(newMount.Source, os.FileMode(mode), idPair)
 		if err != nil {
-			return newMount, nil, fmt.Errorf("unable to change uid,gid of cache directory: %w", err)
+			return newMount, nil, "", fmt.Errorf("unable to change uid,gid of cache directory: %w", err)
 		}
 
 		// create a subdirectory inside `cacheParent` just to store lockfiles
 		buildahLockFilesDir = filepath.Join(cacheParent, buildahLockFilesDir)
 		err = os.MkdirAll(buildahLockFilesDir, os.FileMode(0o700))
 		if err != nil {
-			return newMount, nil, fmt.Errorf("unable to create build cache lockfiles directory: %w", err)
+			return newMount, nil, "", fmt.Errorf("unable to create build cache lockfiles directory: %w", err)
 		}
 	}
 
 	var targetLock *lockfile.LockFile // = nil
+	overlayDir := ""
 	succeeded := false
 	defer func() {
 		if !succeeded && targetLock != nil {
@@ -502,17 +805,54 @@ func GetCacheMount(args []string, _ storage.Store, _ string, additionalMountPoin
 		// lock parent cache
 		lockfile, err := lockfile.GetLockFile(filepath.Join(buildahLockFilesDir, BuildahCacheLockfile))
 		if err != nil {
-			return newMount, nil, fmt.Errorf("unable to acquire lock when sharing mode is locked: %w", err)
+			return newMount, nil, "", fmt.Errorf("unable to acquire lock when sharing mode is locked: %w", err)
 		}
 		// Will be unlocked after the RUN step is executed.
 		lockfile.Lock()
 		targetLock = lockfile
+		// record our pid so that a future GC can tell whether this
+		// lockfile directory was orphaned by a build that crashed
+		// before unlocking it
+		ownerPidFile := filepath.Join(buildahLockFilesDir, "owner.pid")
+		if err := os.WriteFile(ownerPidFile, []byte(strconv.Itoa(os.Getpid())), 0o644); err != nil {
+			logrus.Debugf("recording owner pid for cache lockfile %q: %v", buildahLockFilesDir, err)
+		}
+	case "private":
+		// each build gets its own copy-on-write overlay of the shared
+		// cache directory below, instead of contending with others for
+		// direct access to it; set up once the mount's options are final.
 	case "shared":
 		// do nothing since default is `shared`
 		break
 	default:
 		// error out for unknown values
-		return newMount, nil, fmt.Errorf("unrecognized value %q for field `sharing`: %w", sharing, err)
+		return newMount, nil, "", fmt.Errorf("unrecognized value %q for field `sharing`: %w", sharing, err)
+	}
+
+	// quota enforcement applies no matter how the cache is shared: a
+	// "shared" or "private" cache can still grow without bound, so don't
+	// make max-size/eviction a no-op unless the caller also asked for an
+	// exclusive lock. If we're not already holding the lock (sharing
+	// wasn't "locked"), take it just long enough to evict safely.
+	if cacheDirID != "" && maxSize > 0 {
+		quotaLock := targetLock
+		if quotaLock == nil {
+			quotaLock, err = lockfile.GetLockFile(filepath.Join(buildahLockFilesDir, BuildahCacheLockfile))
+			if err != nil {
+				logrus.Warnf("acquiring lock to enforce cache quota for %q: %v", cacheDirID, err)
+				quotaLock = nil
+			} else {
+				quotaLock.Lock()
+			}
+		}
+		if quotaLock != nil {
+			if err := EnforceCacheQuota(cacheDirID, maxSize, eviction); err != nil {
+				logrus.Warnf("enforcing cache quota for %q: %v", cacheDirID, err)
+			}
+			if quotaLock != targetLock {
+				quotaLock.Unlock()
+			}
+		}
 	}
 
 	// buildkit parity: default sharing should be shared
@@ -530,12 +870,167 @@ func GetCacheMount(args []string, _ storage.Store, _ string, additionalMountPoin
 
 	opts, err := parse.ValidateVolumeOpts(newMount.Options)
 	if err != nil {
-		return newMount, nil, err
+		return newMount, nil, "", err
 	}
 	newMount.Options = opts
 
+	// buildkit parity: "private" sharing gets its own copy-on-write overlay
+	// of the shared cache directory (lower) with a per-build, discarded-on-
+	// unmount upper, so it still sees whatever's already cached instead of
+	// starting from nothing.
+	if sharing == "private" {
+		if newMount, overlayDir, err = convertToOverlay(newMount, store, mountLabel, tmpDir, uid, gid); err != nil {
+			return newMount, nil, "", fmt.Errorf("setting up private overlay for cache mount: %w", err)
+		}
+	}
+
 	succeeded = true
-	return newMount, targetLock, nil
+	return newMount, targetLock, overlayDir, nil
+}
+
+// GetNamedVolumeMount parses a single named-volume mount entry from the
+// --mount flag.
+//
+// Unlike GetCacheMount, the on-disk directory backing the volume is keyed by
+// the volume's name rather than by a digest of its destination, so that the
+// same named volume can be reused across stages, Dockerfiles, and separate
+// `buildah build` invocations. Returns the specified mount and the name of
+// the volume, so that callers can track it for lifecycle management.
+//
+// As with GetSecretMount/GetSSHMount, the volume's backing directory is
+// given a specific owner at creation time via separate uid=/gid= options
+// rather than a combined "uid:gid" value; "chown" here means the same
+// thing it does on GetBindMount/GetTmpfsMount, a boolean alias for "U".
+func GetNamedVolumeMount(args []string, _ storage.Store, workDir string) (specs.Mount, string, error) {
+	var err error
+	newMount := specs.Mount{
+		Type: define.TypeBind,
+	}
+
+	setDest := false
+	name := ""
+	// default volume directory owner is uid 0 unless `uid` is given
+	uid := 0
+	// default volume directory owner is gid 0 unless `gid` is given
+	gid := 0
+
+	for _, val := range args {
+		argName, argValue, hasArgValue := strings.Cut(val, "=")
+		switch argName {
+		case "type":
+			// This is already processed
+			continue
+		case "nosuid", "nodev", "noexec":
+			newMount.Options = append(newMount.Options, argName)
+		case "rw", "readwrite":
+			newMount.Options = append(newMount.Options, "rw")
+		case "ro", "readonly":
+			newMount.Options = append(newMount.Options, "ro")
+		case "Z", "z":
+			newMount.Options = append(newMount.Options, argName)
+		case "chown":
+			// friendlier alias for "U": chown the mount to the effective
+			// UID/GID of the container's run configuration once it's
+			// mounted, same as GetBindMount/GetTmpfsMount. To instead
+			// chown the volume's backing directory to a specific owner at
+			// creation time, use uid=/gid= below.
+			value := true
+			if hasArgValue {
+				var err error
+				if value, err = strconv.ParseBool(argValue); err != nil {
+					return newMount, "", fmt.Errorf("unable to parse value of %q: %w", argName, err)
+				}
+			}
+			if value {
+				newMount.Options = append(newMount.Options, "U")
+			}
+		case "U":
+			newMount.Options = append(newMount.Options, argName)
+		case "idmap":
+			newMount.Options = append(newMount.Options, "idmap")
+		case "src", "source":
+			if !hasArgValue {
+				return newMount, "", fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			name = argValue
+		case "target", "dst", "destination":
+			if !hasArgValue {
+				return newMount, "", fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			targetPath := argValue
+			if !path.IsAbs(targetPath) {
+				targetPath = filepath.Join(workDir, targetPath)
+			}
+			if err := parse.ValidateVolumeCtrDir(targetPath); err != nil {
+				return newMount, "", err
+			}
+			newMount.Destination = targetPath
+			setDest = true
+		case "uid":
+			if !hasArgValue {
+				return newMount, "", fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			if uid, err = strconv.Atoi(argValue); err != nil {
+				return newMount, "", fmt.Errorf("unable to parse requested uid for volume: %w", err)
+			}
+		case "gid":
+			if !hasArgValue {
+				return newMount, "", fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			if gid, err = strconv.Atoi(argValue); err != nil {
+				return newMount, "", fmt.Errorf("unable to parse requested gid for volume: %w", err)
+			}
+		default:
+			return newMount, "", fmt.Errorf("%v: %w", argName, errBadMntOption)
+		}
+	}
+
+	if !setDest {
+		return newMount, "", errBadVolDest
+	}
+	if name == "" {
+		return newMount, "", errBadVolSrc
+	}
+
+	volumeParent := VolumeParent()
+	if err := os.MkdirAll(volumeParent, os.FileMode(0o755)); err != nil {
+		return newMount, "", fmt.Errorf("unable to create build volume directory: %w", err)
+	}
+
+	// Don't let the user control where we place the directory: key it by
+	// a digest of the volume's name so that repeated uses of the same
+	// name resolve to the same on-disk location.
+	dirID := digest.FromString(name).Encoded()[:16]
+	volumeDir := filepath.Join(volumeParent, dirID)
+	if _, err := os.Stat(volumeDir); err != nil {
+		if !os.IsNotExist(err) {
+			return newMount, "", fmt.Errorf("checking for named volume %q: %w", name, err)
+		}
+		idPair := idtools.IDPair{UID: uid, GID: gid}
+		if err := idtools.MkdirAllAndChownNew(volumeDir, os.FileMode(0o755), idPair); err != nil {
+			return newMount, "", fmt.Errorf("unable to create named volume %q: %w", name, err)
+		}
+	}
+	newMount.Source = volumeDir
+
+	// Record the volume's original name in a sidecar file alongside (not
+	// inside, since volumeDir's contents are bind-mounted directly into
+	// the container) its digest-keyed directory: dirID can't be reversed
+	// back into name on its own, which a future `buildah volume` list/rm
+	// subcommand would need to do.
+	if err := os.WriteFile(volumeDir+".name", []byte(name), 0o644); err != nil {
+		return newMount, "", fmt.Errorf("recording name for volume %q: %w", name, err)
+	}
+
+	newMount.Options = append(newMount.Options, "rbind")
+
+	opts, err := parse.ValidateVolumeOpts(newMount.Options)
+	if err != nil {
+		return newMount, "", err
+	}
+	newMount.Options = opts
+
+	return newMount, name, nil
 }
 
 func getVolumeMounts(volumes []string) (map[string]specs.Mount, error) {
@@ -563,13 +1058,26 @@ func UnlockLockArray(locks []*lockfile.LockFile) {
 
 // GetVolumes gets the volumes from --volume and --mount
 //
+// rootfs is the container's already-mounted root filesystem, if one is
+// available yet: when set, every mount destination is re-resolved against
+// it with SecureMountTarget before being handed back, closing the
+// CVE-2021-30465-class TOCTOU window between validating a destination and
+// the runtime actually mounting onto it. Pass "" if no rootfs exists yet
+// (e.g. while only validating --mount/--volume syntax).
+//
 // If this function succeeds, the caller must clean up the returned overlay
-// mounts, unmount the mounted images, and unlock the returned
-// *lockfile.LockFile s if any (when??).
-func GetVolumes(ctx *types.SystemContext, store storage.Store, mountLabel string, volumes []string, mounts []string, contextDir, workDir, tmpDir string) ([]specs.Mount, []string, []string, []*lockfile.LockFile, error) {
-	unifiedMounts, mountedImages, overlayDirs, targetLocks, err := getMounts(ctx, store, mountLabel, mounts, contextDir, workDir, tmpDir)
+// mounts, unmount the mounted images, unlock the returned
+// *lockfile.LockFile s, and run the returned mount cleanup functions (ssh
+// agents, staged secrets, and held secure-destination descriptors) once the
+// RUN step using them has finished.
+// The returned named volume identifiers are not unmounted by the
+// caller: they persist on disk across builds, but are returned so that
+// lifecycle commands (e.g. a future `buildah volume` subcommand) can be
+// hooked up to them.
+func GetVolumes(ctx *types.SystemContext, store storage.Store, mountLabel string, volumes []string, mounts []string, secrets map[string]define.Secret, sshSources map[string]*SSHSource, contextDir, workDir, tmpDir, rootfs string) ([]specs.Mount, []string, []string, []string, []*lockfile.LockFile, []func() error, error) {
+	unifiedMounts, mountedImages, mountedVolumes, overlayDirs, targetLocks, mountCleanups, err := getMounts(ctx, store, mountLabel, mounts, secrets, sshSources, contextDir, workDir, tmpDir, rootfs)
 	if err != nil {
-		return nil, nil, nil, nil, err
+		return nil, nil, nil, nil, nil, nil, err
 	}
 	succeeded := false
 	defer func() {
@@ -585,16 +1093,25 @@ func GetVolumes(ctx *types.SystemContext, store storage.Store, mountLabel string
 				}
 			}
 			UnlockLockArray(targetLocks)
+			runMountCleanups(mountCleanups)
 		}
 	}()
 	volumeMounts, err := getVolumeMounts(volumes)
 	if err != nil {
-		return nil, nil, nil, nil, err
+		return nil, nil, nil, nil, nil, nil, err
 	}
 	for dest, mount := range volumeMounts {
 		if _, ok := unifiedMounts[dest]; ok {
-			return nil, nil, nil, nil, fmt.Errorf("%v: %w", dest, errDuplicateDest)
+			return nil, nil, nil, nil, nil, nil, fmt.Errorf("%v: %w", dest, errDuplicateDest)
 		}
+		resolvedDest, destCleanup, err := resolveSecureDestination(rootfs, dest)
+		if err != nil {
+			return nil, nil, nil, nil, nil, nil, err
+		}
+		if destCleanup != nil {
+			mountCleanups = append(mountCleanups, destCleanup)
+		}
+		mount.Destination = resolvedDest
 		unifiedMounts[dest] = mount
 	}
 
@@ -603,7 +1120,17 @@ func GetVolumes(ctx *types.SystemContext, store storage.Store, mountLabel string
 		finalMounts = append(finalMounts, mount)
 	}
 	succeeded = true
-	return finalMounts, mountedImages, overlayDirs, targetLocks, nil
+	return finalMounts, mountedImages, mountedVolumes, overlayDirs, targetLocks, mountCleanups, nil
+}
+
+// runMountCleanups runs each of cleanups, logging rather than returning any
+// errors, since this is always called on a path that's already unwinding.
+func runMountCleanups(cleanups []func() error) {
+	for _, cleanup := range cleanups {
+		if err := cleanup(); err != nil {
+			logrus.Debugf("cleaning up mount (ssh agent or staged secret): %v", err)
+		}
+	}
 }
 
 // getMounts takes user-provided input from the --mount flag and creates OCI
@@ -612,14 +1139,20 @@ func GetVolumes(ctx *types.SystemContext, store storage.Store, mountLabel string
 // buildah run --mount type=cache,target=/var/cache ...
 // buildah run --mount type=tmpfs,target=/dev/shm ...
 //
-// If this function succeeds, the caller must unlock the returned *lockfile.LockFile s if any (when??).
-func getMounts(ctx *types.SystemContext, store storage.Store, mountLabel string, mounts []string, contextDir, workDir, tmpDir string) (map[string]specs.Mount, []string, []string, []*lockfile.LockFile, error) {
+// If this function succeeds, the caller must unlock the returned
+// *lockfile.LockFile s and run the returned mount cleanup functions (ssh
+// agents, staged secrets, and held secure-destination descriptors) once
+// they're no longer needed.
+func getMounts(ctx *types.SystemContext, store storage.Store, mountLabel string, mounts []string, secrets map[string]define.Secret, sshSources map[string]*SSHSource, contextDir, workDir, tmpDir, rootfs string) (map[string]specs.Mount, []string, []string, []string, []*lockfile.LockFile, []func() error, error) {
 	// If `type` is not set default to "bind"
 	mountType := define.TypeBind
 	finalMounts := make(map[string]specs.Mount, len(mounts))
 	mountedImages := make([]string, 0, len(mounts))
+	mountedVolumes := make([]string, 0, len(mounts))
 	overlayDirs := make([]string, 0, len(mounts))
 	targetLocks := make([]*lockfile.LockFile, 0, len(mounts))
+	mountCleanups := make([]func() error, 0, len(mounts))
+	sshMountIndex := 0
 	succeeded := false
 	defer func() {
 		if !succeeded {
@@ -634,10 +1167,35 @@ func getMounts(ctx *types.SystemContext, store storage.Store, mountLabel string,
 				}
 			}
 			UnlockLockArray(targetLocks)
+			runMountCleanups(mountCleanups)
 		}
 	}()
 
-	errInvalidSyntax := errors.New("incorrect mount format: should be --mount type=<bind|tmpfs>,[src=<host-dir>,]target=<ctr-dir>[,options]")
+	// insertMount re-resolves mount's destination against rootfs (a no-op
+	// if rootfs is "") before recording it, so every --mount realization
+	// (bind, image, volume, cache, tmpfs, devpts, secret, ssh) gets the same
+	// TOCTOU-safe treatment instead of just the ones that happen to call
+	// SecureMountTarget themselves.
+	// Mounts are keyed by the requested destination: each resolution opens a
+	// fresh descriptor, so its magic-link path is never the same twice.
+	insertMount := func(mount specs.Mount) error {
+		dest := mount.Destination
+		if _, ok := finalMounts[dest]; ok {
+			return fmt.Errorf("%v: %w", dest, errDuplicateDest)
+		}
+		resolvedDest, destCleanup, err := resolveSecureDestination(rootfs, dest)
+		if err != nil {
+			return err
+		}
+		if destCleanup != nil {
+			mountCleanups = append(mountCleanups, destCleanup)
+		}
+		mount.Destination = resolvedDest
+		finalMounts[dest] = mount
+		return nil
+	}
+
+	errInvalidSyntax := fmt.Errorf("incorrect mount format: should be --mount type=<%s>,[src=<host-dir>,]target=<ctr-dir>[,options]", strings.Join(SupportedMountTypes, "|"))
 
 	// TODO(vrothberg): the manual parsing can be replaced with a regular expression
 	//                  to allow a more robust parsing of the mount format and to give
@@ -645,13 +1203,13 @@ func getMounts(ctx *types.SystemContext, store storage.Store, mountLabel string,
 	for _, mount := range mounts {
 		tokens := strings.Split(mount, ",")
 		if len(tokens) < 2 {
-			return nil, nil, nil, nil, fmt.Errorf("%q: %w", mount, errInvalidSyntax)
+			return nil, nil, nil, nil, nil, nil, fmt.Errorf("%q: %w", mount, errInvalidSyntax)
 		}
 		for _, field := range tokens {
 			if strings.HasPrefix(field, "type=") {
 				kv := strings.Split(field, "=")
 				if len(kv) != 2 {
-					return nil, nil, nil, nil, fmt.Errorf("%q: %w", mount, errInvalidSyntax)
+					return nil, nil, nil, nil, nil, nil, fmt.Errorf("%q: %w", mount, errInvalidSyntax)
 				}
 				mountType = kv[1]
 			}
@@ -660,7 +1218,7 @@ func getMounts(ctx *types.SystemContext, store storage.Store, mountLabel string,
 		case define.TypeBind:
 			mount, image, overlayDir, err := GetBindMount(ctx, tokens, contextDir, store, mountLabel, nil, workDir, tmpDir)
 			if err != nil {
-				return nil, nil, nil, nil, err
+				return nil, nil, nil, nil, nil, nil, err
 			}
 			if image != "" {
 				mountedImages = append(mountedImages, image)
@@ -668,38 +1226,91 @@ func getMounts(ctx *types.SystemContext, store storage.Store, mountLabel string,
 			if overlayDir != "" {
 				overlayDirs = append(overlayDirs, overlayDir)
 			}
-			if _, ok := finalMounts[mount.Destination]; ok {
-				return nil, nil, nil, nil, fmt.Errorf("%v: %w", mount.Destination, errDuplicateDest)
+			if err := insertMount(mount); err != nil {
+				return nil, nil, nil, nil, nil, nil, err
+			}
+		case TypeImage:
+			mount, image, overlayDir, err := GetImageMount(ctx, tokens, store, mountLabel, nil, workDir, tmpDir)
+			if err != nil {
+				return nil, nil, nil, nil, nil, nil, err
+			}
+			if image != "" {
+				mountedImages = append(mountedImages, image)
+			}
+			if overlayDir != "" {
+				overlayDirs = append(overlayDirs, overlayDir)
+			}
+			if err := insertMount(mount); err != nil {
+				return nil, nil, nil, nil, nil, nil, err
+			}
+		case TypeVolume:
+			mount, volume, err := GetNamedVolumeMount(tokens, store, workDir)
+			if err != nil {
+				return nil, nil, nil, nil, nil, nil, err
+			}
+			mountedVolumes = append(mountedVolumes, volume)
+			if err := insertMount(mount); err != nil {
+				return nil, nil, nil, nil, nil, nil, err
 			}
-			finalMounts[mount.Destination] = mount
 		case TypeCache:
-			mount, tl, err := GetCacheMount(tokens, store, "", nil, workDir)
+			mount, tl, overlayDir, err := GetCacheMount(tokens, store, mountLabel, nil, workDir, tmpDir)
 			if err != nil {
-				return nil, nil, nil, nil, err
+				return nil, nil, nil, nil, nil, nil, err
 			}
 			if tl != nil {
 				targetLocks = append(targetLocks, tl)
 			}
-			if _, ok := finalMounts[mount.Destination]; ok {
-				return nil, nil, nil, nil, fmt.Errorf("%v: %w", mount.Destination, errDuplicateDest)
+			if overlayDir != "" {
+				overlayDirs = append(overlayDirs, overlayDir)
+			}
+			if err := insertMount(mount); err != nil {
+				return nil, nil, nil, nil, nil, nil, err
 			}
-			finalMounts[mount.Destination] = mount
 		case TypeTmpfs:
 			mount, err := GetTmpfsMount(tokens, workDir)
 			if err != nil {
-				return nil, nil, nil, nil, err
+				return nil, nil, nil, nil, nil, nil, err
+			}
+			if err := insertMount(mount); err != nil {
+				return nil, nil, nil, nil, nil, nil, err
+			}
+		case TypeDevpts:
+			mount, err := GetDevptsMount(tokens, workDir)
+			if err != nil {
+				return nil, nil, nil, nil, nil, nil, err
+			}
+			if err := insertMount(mount); err != nil {
+				return nil, nil, nil, nil, nil, nil, err
+			}
+		case TypeSecret:
+			mount, mounted, cleanup, err := GetSecretMount(tokens, secrets, tmpDir)
+			if err != nil {
+				return nil, nil, nil, nil, nil, nil, err
+			}
+			if !mounted {
+				continue
+			}
+			mountCleanups = append(mountCleanups, cleanup)
+			if err := insertMount(mount); err != nil {
+				return nil, nil, nil, nil, nil, nil, err
+			}
+		case TypeSSH:
+			mount, cleanup, err := GetSSHMount(tokens, sshMountIndex, sshSources, tmpDir)
+			if err != nil {
+				return nil, nil, nil, nil, nil, nil, err
 			}
-			if _, ok := finalMounts[mount.Destination]; ok {
-				return nil, nil, nil, nil, fmt.Errorf("%v: %w", mount.Destination, errDuplicateDest)
+			sshMountIndex++
+			mountCleanups = append(mountCleanups, cleanup)
+			if err := insertMount(mount); err != nil {
+				return nil, nil, nil, nil, nil, nil, err
 			}
-			finalMounts[mount.Destination] = mount
 		default:
-			return nil, nil, nil, nil, fmt.Errorf("invalid filesystem type %q", mountType)
+			return nil, nil, nil, nil, nil, nil, fmt.Errorf("invalid filesystem type %q", mountType)
 		}
 	}
 
 	succeeded = true
-	return finalMounts, mountedImages, overlayDirs, targetLocks, nil
+	return finalMounts, mountedImages, mountedVolumes, overlayDirs, targetLocks, mountCleanups, nil
 }
 
 // GetTmpfsMount parses a single tmpfs mount entry from the --mount flag
@@ -710,6 +1321,12 @@ func GetTmpfsMount(args []string, workDir string) (specs.Mount, error) {
 	}
 
 	setDest := false
+	foundTmpcopyup := false
+	foundNotmpcopyup := false
+	foundRo, foundRw := false, false
+	foundSuid, foundNosuid := false, false
+	foundDev, foundNodev := false, false
+	foundExec, foundNoexec := false, false
 
 	for _, val := range args {
 		argName, argValue, hasArgValue := strings.Cut(val, "=")
@@ -717,14 +1334,88 @@ func GetTmpfsMount(args []string, workDir string) (specs.Mount, error) {
 		case "type":
 			// This is already processed
 			continue
-		case "ro", "nosuid", "nodev", "noexec":
-			newMount.Options = append(newMount.Options, argName)
-		case "readonly":
-			// Alias for "ro"
+		case "ro", "readonly":
+			if foundRw {
+				return newMount, fmt.Errorf("cannot set both 'rw' and %q: %w", argName, errBadMntOption)
+			}
+			foundRo = true
 			newMount.Options = append(newMount.Options, "ro")
+		case "rw":
+			// explicit read-write; a tmpfs mount is writable unless "ro" is given
+			if foundRo {
+				return newMount, fmt.Errorf("cannot set both 'ro' and 'rw': %w", errBadMntOption)
+			}
+			foundRw = true
+			newMount.Options = append(newMount.Options, "rw")
+		case "nosuid":
+			if foundSuid {
+				return newMount, fmt.Errorf("cannot set both 'suid' and 'nosuid': %w", errBadMntOption)
+			}
+			foundNosuid = true
+			newMount.Options = append(newMount.Options, "nosuid")
+		case "suid":
+			// cancel buildah's default of adding "nosuid" to tmpfs mounts
+			if foundNosuid {
+				return newMount, fmt.Errorf("cannot set both 'suid' and 'nosuid': %w", errBadMntOption)
+			}
+			foundSuid = true
+			newMount.Options = append(newMount.Options, "suid")
+		case "nodev":
+			if foundDev {
+				return newMount, fmt.Errorf("cannot set both 'dev' and 'nodev': %w", errBadMntOption)
+			}
+			foundNodev = true
+			newMount.Options = append(newMount.Options, "nodev")
+		case "dev":
+			// cancel buildah's default of adding "nodev" to tmpfs mounts
+			if foundNodev {
+				return newMount, fmt.Errorf("cannot set both 'dev' and 'nodev': %w", errBadMntOption)
+			}
+			foundDev = true
+			newMount.Options = append(newMount.Options, "dev")
+		case "noexec":
+			if foundExec {
+				return newMount, fmt.Errorf("cannot set both 'exec' and 'noexec': %w", errBadMntOption)
+			}
+			foundNoexec = true
+			newMount.Options = append(newMount.Options, "noexec")
+		case "exec":
+			// cancel buildah's default of adding "noexec" to tmpfs mounts
+			if foundNoexec {
+				return newMount, fmt.Errorf("cannot set both 'exec' and 'noexec': %w", errBadMntOption)
+			}
+			foundExec = true
+			newMount.Options = append(newMount.Options, "exec")
 		case "tmpcopyup":
 			// the path that is shadowed by the tmpfs mount is recursively copied up to the tmpfs itself.
+			if foundNotmpcopyup {
+				return newMount, fmt.Errorf("cannot set both 'tmpcopyup' and 'notmpcopyup': %w", errBadMntOption)
+			}
+			foundTmpcopyup = true
 			newMount.Options = append(newMount.Options, argName)
+		case "notmpcopyup":
+			// explicit opt-out of copy-up; no "tmpcopyup" option is added
+			// unless requested, so this only rejects a conflicting "tmpcopyup"
+			if foundTmpcopyup {
+				return newMount, fmt.Errorf("cannot set both 'tmpcopyup' and 'notmpcopyup': %w", errBadMntOption)
+			}
+			foundNotmpcopyup = true
+		case "chown":
+			// chown the tmpfs root to the effective UID/GID of the container's
+			// run configuration once it's mounted; "U" is the runtime-spec
+			// mount option that requests exactly this.
+			value := true
+			if hasArgValue {
+				var err error
+				if value, err = strconv.ParseBool(argValue); err != nil {
+					return newMount, fmt.Errorf("unable to parse value of %q: %w", argName, err)
+				}
+			}
+			if value {
+				newMount.Options = append(newMount.Options, "U")
+			}
+		case "idmap":
+			newMount.Options = append(newMount.Options, "idmap")
 		case "tmpfs-mode":
 			if !hasArgValue {
 				return newMount, fmt.Errorf("%v: %w", argName, errBadOptionArg)
@@ -759,5 +1450,112 @@ func GetTmpfsMount(args []string, workDir string) (specs.Mount, error) {
 		return newMount, errBadVolDest
 	}
 
+	// a tmpfs has no host source to inherit flags from directly, but the
+	// build's working directory is as good a proxy as we have for "the
+	// filesystem this build is already constrained by": if it's mounted
+	// nosuid/nodev/noexec, a freshly-minted tmpfs shouldn't silently relax
+	// that unless the caller asked for suid/dev/exec explicitly.
+	if inherited, err := defaultMountOptsFor(workDir); err == nil {
+		for _, opt := range inherited {
+			switch opt {
+			case "nosuid":
+				if !foundSuid && !foundNosuid {
+					newMount.Options = append(newMount.Options, "nosuid")
+				}
+			case "nodev":
+				if !foundDev && !foundNodev {
+					newMount.Options = append(newMount.Options, "nodev")
+				}
+			case "noexec":
+				if !foundExec && !foundNoexec {
+					newMount.Options = append(newMount.Options, "noexec")
+				}
+			}
+		}
+	}
+
+	return newMount, nil
+}
+
+// GetDevptsMount parses a single devpts mount entry from the --mount flag,
+// for mounting a fresh pseudo-terminal instance into the container instead
+// of sharing the one inherited from the host.
+func GetDevptsMount(args []string, workDir string) (specs.Mount, error) {
+	newMount := specs.Mount{
+		Type:   TypeDevpts,
+		Source: TypeDevpts,
+	}
+
+	setDest := false
+
+	for _, val := range args {
+		argName, argValue, hasArgValue := strings.Cut(val, "=")
+		switch argName {
+		case "type":
+			// This is already processed
+			continue
+		case "newinstance":
+			newMount.Options = append(newMount.Options, argName)
+		case "uid":
+			if !hasArgValue {
+				return newMount, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			newMount.Options = append(newMount.Options, fmt.Sprintf("uid=%s", argValue))
+		case "gid":
+			if !hasArgValue {
+				return newMount, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			newMount.Options = append(newMount.Options, fmt.Sprintf("gid=%s", argValue))
+		case "mode":
+			if !hasArgValue {
+				return newMount, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			newMount.Options = append(newMount.Options, fmt.Sprintf("mode=%s", argValue))
+		case "ptmxmode":
+			if !hasArgValue {
+				return newMount, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			newMount.Options = append(newMount.Options, fmt.Sprintf("ptmxmode=%s", argValue))
+		case "max":
+			if !hasArgValue {
+				return newMount, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			newMount.Options = append(newMount.Options, fmt.Sprintf("max=%s", argValue))
+		case "src", "source":
+			return newMount, errors.New("source is not supported with devpts mounts")
+		case "target", "dst", "destination":
+			if !hasArgValue {
+				return newMount, fmt.Errorf("%v: %w", argName, errBadOptionArg)
+			}
+			targetPath := argValue
+			if !path.IsAbs(targetPath) {
+				targetPath = filepath.Join(workDir, targetPath)
+			}
+			if err := parse.ValidateVolumeCtrDir(targetPath); err != nil {
+				return newMount, err
+			}
+			newMount.Destination = targetPath
+			setDest = true
+		default:
+			return newMount, fmt.Errorf("%v: %w", argName, errBadMntOption)
+		}
+	}
+
+	if !setDest {
+		return newMount, errBadVolDest
+	}
+
+	// same reasoning as GetTmpfsMount: inherit nosuid/nodev/noexec from the
+	// build's working directory, since devpts has no host source of its own
+	// to statfs.
+	if inherited, err := defaultMountOptsFor(workDir); err == nil {
+		for _, opt := range inherited {
+			switch opt {
+			case "nosuid", "nodev", "noexec":
+				newMount.Options = append(newMount.Options, opt)
+			}
+		}
+	}
+
 	return newMount, nil
 }
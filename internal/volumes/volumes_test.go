@@ -0,0 +1,116 @@
+package volumes
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// cleanupNamedVolume removes the on-disk directory and sidecar name file
+// GetNamedVolumeMount creates for name, so tests don't leak state into the
+// shared volume parent directory across runs.
+func cleanupNamedVolume(t *testing.T, name string) {
+	t.Helper()
+	dirID := digest.FromString(name).Encoded()[:16]
+	volumeDir := filepath.Join(VolumeParent(), dirID)
+	if err := os.RemoveAll(volumeDir); err != nil {
+		t.Logf("cleaning up volume directory %q: %v", volumeDir, err)
+	}
+	if err := os.Remove(volumeDir + ".name"); err != nil && !os.IsNotExist(err) {
+		t.Logf("cleaning up volume name sidecar %q: %v", volumeDir, err)
+	}
+}
+
+func TestGetNamedVolumeMountWritesNameSidecar(t *testing.T) {
+	name := fmt.Sprintf("test-volume-%d", os.Getpid())
+	t.Cleanup(func() { cleanupNamedVolume(t, name) })
+
+	mount, volume, err := GetNamedVolumeMount([]string{
+		"type=volume",
+		"source=" + name,
+		"target=/data",
+	}, nil, t.TempDir())
+	if err != nil {
+		t.Fatalf("GetNamedVolumeMount: %v", err)
+	}
+	if volume != name {
+		t.Fatalf("expected returned volume name %q, got %q", name, volume)
+	}
+	if mount.Destination != "/data" {
+		t.Fatalf("expected destination /data, got %q", mount.Destination)
+	}
+
+	got, err := os.ReadFile(mount.Source + ".name")
+	if err != nil {
+		t.Fatalf("reading name sidecar: %v", err)
+	}
+	if string(got) != name {
+		t.Fatalf("expected name sidecar to contain %q, got %q", name, got)
+	}
+}
+
+func TestGetNamedVolumeMountChownIsBooleanUAlias(t *testing.T) {
+	name := fmt.Sprintf("test-volume-chown-%d", os.Getpid())
+	t.Cleanup(func() { cleanupNamedVolume(t, name) })
+
+	mount, _, err := GetNamedVolumeMount([]string{
+		"type=volume",
+		"source=" + name,
+		"target=/data",
+		"chown",
+	}, nil, t.TempDir())
+	if err != nil {
+		t.Fatalf("GetNamedVolumeMount: %v", err)
+	}
+
+	found := false
+	for _, opt := range mount.Options {
+		if opt == "U" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected chown to add the \"U\" option, got %v", mount.Options)
+	}
+}
+
+func TestGetNamedVolumeMountUidGid(t *testing.T) {
+	name := fmt.Sprintf("test-volume-uidgid-%d", os.Getpid())
+	t.Cleanup(func() { cleanupNamedVolume(t, name) })
+
+	mount, _, err := GetNamedVolumeMount([]string{
+		"type=volume",
+		"source=" + name,
+		"target=/data",
+		"uid=123",
+		"gid=456",
+	}, nil, t.TempDir())
+	if err != nil {
+		t.Fatalf("GetNamedVolumeMount: %v", err)
+	}
+
+	info, err := os.Stat(mount.Source)
+	if err != nil {
+		t.Fatalf("statting volume directory: %v", err)
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		t.Skip("can't read raw uid/gid on this platform")
+	}
+	if st.Uid != 123 || st.Gid != 456 {
+		t.Fatalf("expected volume directory to be owned by 123:456, got %d:%d", st.Uid, st.Gid)
+	}
+}
+
+func TestGetNamedVolumeMountRequiresDestinationAndSource(t *testing.T) {
+	if _, _, err := GetNamedVolumeMount([]string{"type=volume", "source=whatever"}, nil, t.TempDir()); err == nil {
+		t.Fatalf("expected an error for a missing target")
+	}
+	if _, _, err := GetNamedVolumeMount([]string{"type=volume", "target=/data"}, nil, t.TempDir()); err == nil {
+		t.Fatalf("expected an error for a missing source")
+	}
+}